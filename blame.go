@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mycroft/git-reader/internal/git"
+)
+
+// writeBlameLine writes a line of the blamed file, adding the line feed missing at the end of the file if needed
+func writeBlameLine(out io.Writer, line string) {
+	fmt.Fprint(out, line)
+	if !strings.HasSuffix(line, "\n") {
+		fmt.Fprintln(out)
+	}
+}
+
+// writeBlamePorcelain writes a blame as git blame --porcelain does: details about a commit are only given the first
+// time it is seen, or for every line if repeat is set
+func writeBlamePorcelain(out io.Writer, blame *git.FileBlame, repeat bool) {
+	shown := make(map[git.ObjectID]bool)
+
+	// commits blamed under more than one path always come with the file name
+	paths := make(map[git.ObjectID]map[string]bool)
+	for _, entry := range blame.Entries {
+		if paths[entry.Origin.Commit.Hash] == nil {
+			paths[entry.Origin.Commit.Hash] = make(map[string]bool)
+		}
+		paths[entry.Origin.Commit.Hash][entry.Origin.Path] = true
+	}
+
+	writeDetails := func(origin *git.BlameOrigin) {
+		commit := origin.Commit
+
+		if repeat || !shown[commit.Hash] {
+			shown[commit.Hash] = true
+
+			fmt.Fprintf(out, "author %s\n", commit.Author.Name)
+			fmt.Fprintf(out, "author-mail <%s>\n", commit.Author.Email)
+			fmt.Fprintf(out, "author-time %d\n", commit.Author.When.Unix())
+			fmt.Fprintf(out, "author-tz %s\n", commit.Author.When.Format("-0700"))
+			fmt.Fprintf(out, "committer %s\n", commit.Committer.Name)
+			fmt.Fprintf(out, "committer-mail <%s>\n", commit.Committer.Email)
+			fmt.Fprintf(out, "committer-time %d\n", commit.Committer.When.Unix())
+			fmt.Fprintf(out, "committer-tz %s\n", commit.Committer.When.Format("-0700"))
+			fmt.Fprintf(out, "summary %s\n", commit.Title())
+			if origin.IsBoundary() {
+				fmt.Fprintln(out, "boundary")
+			}
+		} else if len(paths[commit.Hash]) < 2 {
+			return
+		}
+
+		if origin.Previous != nil {
+			fmt.Fprintf(out, "previous %s %s\n", origin.Previous.Commit.Hash, git.QuotePath(origin.Previous.Path))
+		}
+		fmt.Fprintf(out, "filename %s\n", git.QuotePath(origin.Path))
+	}
+
+	for _, entry := range blame.Entries {
+		hash := entry.Origin.Commit.Hash
+
+		for n := 0; n < entry.Count; n++ {
+			if n == 0 {
+				fmt.Fprintf(out, "%s %d %d %d\n", hash, entry.OrigStart, entry.FinalStart, entry.Count)
+				writeDetails(entry.Origin)
+			} else {
+				fmt.Fprintf(out, "%s %d %d\n", hash, entry.OrigStart+n, entry.FinalStart+n)
+				if repeat {
+					writeDetails(entry.Origin)
+				}
+			}
+
+			fmt.Fprint(out, "\t")
+			writeBlameLine(out, blame.Lines[entry.FinalStart-1+n])
+		}
+	}
+}
+
+// writeBlame writes a blame as git blame does by default. Hashes are abbreviated to one more character than needed,
+// so boundary commits can be marked with a caret. File names are shown if the file had other names.
+func writeBlame(out io.Writer, repository git.Repository, blame *git.FileBlame) {
+	abbrev, longestAuthor, longestPath, showPath := 0, 0, 0, false
+
+	for _, entry := range blame.Entries {
+		abbrev = max(abbrev, len(repository.AbbreviateHash(entry.Origin.Commit.Hash))+1)
+		longestAuthor = max(longestAuthor, utf8.RuneCountInString(entry.Origin.Commit.Author.Name))
+		longestPath = max(longestPath, len(entry.Origin.Path))
+		if entry.Origin.Path != blame.Path {
+			showPath = true
+		}
+	}
+
+	digits := len(fmt.Sprint(len(blame.Lines)))
+
+	for _, entry := range blame.Entries {
+		commit := entry.Origin.Commit
+
+		hash := commit.Hash.String()[:abbrev]
+		if entry.Origin.IsBoundary() {
+			hash = "^" + commit.Hash.String()[:abbrev-1]
+		}
+
+		name := ""
+		if showPath {
+			name = fmt.Sprintf(" %-*s", longestPath, entry.Origin.Path)
+		}
+
+		author := commit.Author.Name + strings.Repeat(" ", longestAuthor-utf8.RuneCountInString(commit.Author.Name))
+		date := commit.Author.When.Format("2006-01-02 15:04:05 -0700")
+
+		for n := 0; n < entry.Count; n++ {
+			fmt.Fprintf(out, "%s%s (%s %s %*d) ", hash, name, author, date, digits, entry.FinalStart+n)
+			writeBlameLine(out, blame.Lines[entry.FinalStart-1+n])
+		}
+	}
+}
+
+// runBlame prints each line of a file along with the commit which introduced it
+func runBlame(repository git.Repository, args []string) error {
+	var porcelain, linePorcelain, noFollow, histogram bool
+
+	flags := flag.NewFlagSet("blame", flag.ExitOnError)
+	flags.BoolVar(&porcelain, "porcelain", false, "Show the output in a format designed for machine consumption")
+	flags.BoolVar(&linePorcelain, "line-porcelain", false, "Show the porcelain format, with commit details for each line")
+	flags.BoolVar(&noFollow, "no-follow", false, "Do not follow the file through renames")
+	flags.BoolVar(&histogram, "histogram", false, "Use the histogram diff instead of Myers")
+	revs := parseArgs(flags, args)
+
+	rev, path := "HEAD", ""
+	switch len(revs) {
+	case 1:
+		path = revs[0]
+	case 2:
+		rev, path = revs[0], revs[1]
+	default:
+		return fmt.Errorf("usage: blame [-porcelain] [-line-porcelain] [-no-follow] [-histogram] [<rev>] <path>")
+	}
+
+	options := &git.BlameOptions{FollowRenames: !noFollow}
+	if histogram {
+		options.Algorithm = git.DIFF_ALGORITHM_HISTOGRAM
+	}
+
+	blame, err := repository.Blame(rev, path, options)
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	if porcelain || linePorcelain {
+		writeBlamePorcelain(out, blame, linePorcelain)
+	} else {
+		writeBlame(out, repository, blame)
+	}
+
+	return nil
+}
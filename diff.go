@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mycroft/git-reader/internal/git"
+)
+
+// diffOutput holds the diff options shared by diff & show
+type diffOutput struct {
+	nameStatus, nameOnly, stat, numstat, patch bool
+	noRenames, findCopies, findCopiesHarder    bool
+	histogram                                  bool
+	context                                    int
+	algorithm                                  string
+}
+
+func addDiffFlags(flags *flag.FlagSet) *diffOutput {
+	output := &diffOutput{}
+
+	flags.BoolVar(&output.nameStatus, "name-status", false, "Show only names and status of changed files")
+	flags.BoolVar(&output.nameOnly, "name-only", false, "Show only names of changed files")
+	flags.BoolVar(&output.stat, "stat", false, "Show a histogram of changes per file")
+	flags.BoolVar(&output.numstat, "numstat", false, "Show the number of added and deleted lines per file")
+	flags.BoolVar(&output.patch, "p", false, "Show the patch along with -stat, -numstat...")
+	flags.BoolVar(&output.patch, "patch", false, "Show the patch along with -stat, -numstat...")
+	flags.IntVar(&output.context, "U", git.DEFAULT_CONTEXT_LINES, "Number of context lines")
+	flags.IntVar(&output.context, "unified", git.DEFAULT_CONTEXT_LINES, "Number of context lines")
+	flags.StringVar(&output.algorithm, "diff-algorithm", "myers", "Diff algorithm: myers or histogram")
+	flags.BoolVar(&output.histogram, "histogram", false, "Shorthand for -diff-algorithm histogram")
+	flags.BoolVar(&output.noRenames, "no-renames", false, "Turn off rename detection")
+	flags.Bool("M", true, "Detect renames (default)")
+	flags.BoolVar(&output.findCopies, "C", false, "Detect copies as well as renames")
+	flags.BoolVar(&output.findCopiesHarder, "find-copies-harder", false, "Detect copies from unmodified files as well")
+
+	return output
+}
+
+// changes returns the changes between two trees
+func (output *diffOutput) changes(repository git.Repository, oldTree, newTree git.ObjectID) ([]git.TreeChange, error) {
+	return repository.DiffTrees(oldTree, newTree, &git.DiffOptions{
+		DetectRenames:    !output.noRenames || output.findCopies || output.findCopiesHarder,
+		DetectCopies:     output.findCopies || output.findCopiesHarder,
+		FindCopiesHarder: output.findCopiesHarder,
+	})
+}
+
+func (output *diffOutput) patchOptions() (*git.PatchOptions, error) {
+	options := &git.PatchOptions{ContextLines: output.context}
+
+	if output.histogram {
+		output.algorithm = "histogram"
+	}
+
+	switch output.algorithm {
+	case "myers", "default":
+		options.Algorithm = git.DIFF_ALGORITHM_MYERS
+	case "histogram":
+		options.Algorithm = git.DIFF_ALGORITHM_HISTOGRAM
+	default:
+		return nil, fmt.Errorf("unsupported diff algorithm: %s", output.algorithm)
+	}
+
+	return options, nil
+}
+
+// showsPatch returns true if patches are printed: by default, or along with stats if asked for
+func (output *diffOutput) showsPatch() bool {
+	if output.nameStatus || output.nameOnly {
+		return false
+	}
+	return output.patch || !(output.stat || output.numstat)
+}
+
+// print prints changes in the requested formats, in the order git does. As with git, names only or with status
+// are not shown along with other formats.
+func (output *diffOutput) print(repository git.Repository, changes []git.TreeChange) error {
+	if output.nameOnly {
+		printNameOnly(changes)
+		return nil
+	}
+	if output.nameStatus {
+		printNameStatus(changes)
+		return nil
+	}
+
+	options, err := output.patchOptions()
+	if err != nil {
+		return err
+	}
+
+	patches := make([]*git.FilePatch, 0, len(changes))
+	for _, change := range changes {
+		patch, err := repository.NewFilePatch(change, options)
+		if err != nil {
+			return err
+		}
+		patches = append(patches, patch)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	separator := false
+
+	if output.numstat {
+		if err := git.WriteNumStat(out, patches); err != nil {
+			return err
+		}
+		separator = true
+	}
+
+	if output.stat {
+		if err := git.WriteDiffStat(out, patches, 0); err != nil {
+			return err
+		}
+		separator = true
+	}
+
+	if !output.showsPatch() {
+		return nil
+	}
+
+	if separator && len(patches) > 0 {
+		fmt.Fprintln(out)
+	}
+
+	for _, patch := range patches {
+		if err := repository.WritePatch(out, patch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resolveTree resolves a revision into a tree hash
+func resolveTree(repository git.Repository, rev string) (git.ObjectID, error) {
+	return repository.ResolveRevision(rev + "^{tree}")
+}
+
+// commitTrees returns a commit, and the trees of its first parent and of itself. The parent tree of a root commit
+// is empty, with a null hash.
+func commitTrees(repository git.Repository, rev string) (*git.Commit, git.ObjectID, git.ObjectID, error) {
+	hash, err := repository.ResolveRevision(rev + "^{commit}")
+	if err != nil {
+		return nil, git.ObjectID{}, git.ObjectID{}, err
+	}
+
+	commit, err := repository.OpenCommit(hash)
+	if err != nil {
+		return nil, git.ObjectID{}, git.ObjectID{}, err
+	}
+
+	parentTree := git.ObjectID{}
+	if len(commit.Parents) > 0 {
+		if parentTree, err = resolveTree(repository, commit.Parents[0].String()); err != nil {
+			return nil, git.ObjectID{}, git.ObjectID{}, err
+		}
+	}
+
+	return commit, parentTree, commit.Tree, nil
+}
+
+// printNameStatus prints changes as git diff --name-status does
+func printNameStatus(changes []git.TreeChange) {
+	for _, change := range changes {
+		switch change.Type {
+		case git.CHANGE_RENAMED, git.CHANGE_COPIED:
+			fmt.Printf("%c%03d\t%s\t%s\n", change.Type, change.Similarity, git.QuotePath(change.OldPath), git.QuotePath(change.NewPath))
+		default:
+			fmt.Printf("%c\t%s\n", change.Type, git.QuotePath(change.Path()))
+		}
+	}
+}
+
+// printNameOnly prints the paths of changed files
+func printNameOnly(changes []git.TreeChange) {
+	for _, change := range changes {
+		fmt.Println(git.QuotePath(change.Path()))
+	}
+}
+
+// runDiff prints the changes between two revisions, or brought by a commit if a single one is given
+func runDiff(repository git.Repository, args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	output := addDiffFlags(flags)
+	revs := parseArgs(flags, args)
+
+	var oldTree, newTree git.ObjectID
+	var err error
+
+	switch len(revs) {
+	case 1:
+		if _, oldTree, newTree, err = commitTrees(repository, revs[0]); err != nil {
+			return err
+		}
+
+	case 2:
+		if oldTree, err = resolveTree(repository, revs[0]); err != nil {
+			return err
+		}
+		if newTree, err = resolveTree(repository, revs[1]); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("usage: diff [-stat] [-numstat] [-name-status] [-name-only] [-U <n>] [-C] <rev> [<rev>]")
+	}
+
+	changes, err := output.changes(repository, oldTree, newTree)
+	if err != nil {
+		return err
+	}
+
+	return output.print(repository, changes)
+}
+
+// runShow prints a commit, then its changes against its first parent
+func runShow(repository git.Repository, args []string) error {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	output := addDiffFlags(flags)
+	revs := parseArgs(flags, args)
+
+	if len(revs) == 0 {
+		revs = []string{"HEAD"}
+	}
+
+	for n, rev := range revs {
+		commit, oldTree, newTree, err := commitTrees(repository, rev)
+		if err != nil {
+			return err
+		}
+
+		changes, err := output.changes(repository, oldTree, newTree)
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			fmt.Println()
+		}
+		printCommit(commit, "full")
+
+		if len(changes) == 0 {
+			continue
+		}
+
+		// the message is separated from the diff by a blank line, or by "---" when both stat & patch are shown
+		if output.stat && output.showsPatch() {
+			fmt.Print("---")
+		}
+		fmt.Println()
+
+		if err := output.print(repository, changes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
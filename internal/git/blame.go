@@ -0,0 +1,388 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type BlameOptions struct {
+	FollowRenames bool // follow the file through whole file renames
+	Algorithm     DiffAlgorithm
+}
+
+// BlameOrigin is a version of the blamed file: its path and blob at a commit
+type BlameOrigin struct {
+	Commit   *Commit
+	Path     string
+	Hash     ObjectID
+	Mode     int
+	Previous *BlameOrigin // version of the file in the first parent having it, nil if the file was added
+}
+
+// IsBoundary returns true if the origin's commit is where the history walk stopped. As git does, root commits are
+// boundaries.
+func (origin *BlameOrigin) IsBoundary() bool {
+	return len(origin.Commit.Parents) == 0
+}
+
+// BlameEntry is a range of lines of the blamed file, attributed to the origin which introduced them
+type BlameEntry struct {
+	Origin     *BlameOrigin
+	OrigStart  int // first line in the origin's version of the file, starting at 1
+	FinalStart int // first line in the blamed file, starting at 1
+	Count      int
+}
+
+// FileBlame is a file at a revision, along with the origin of each of its lines
+type FileBlame struct {
+	Path    string
+	Lines   []string     // lines of the blamed file, with their line feed
+	Entries []BlameEntry // ordered by line, consecutive lines from the same origin being grouped
+}
+
+// blameSuspect is a range of lines of the blamed file, still to be attributed. Lines start at 0.
+type blameSuspect struct {
+	start, count int
+	orig         int // first line in the suspected origin's version of the file
+}
+
+type blameOriginKey struct {
+	commit ObjectID
+	path   string
+}
+
+// blameScoreboard holds the state of a blame: origins and the lines they are suspected of, to be passed down to
+// parents as long as they are unchanged, as git blame does
+type blameScoreboard struct {
+	repo    Repository
+	options *BlameOptions
+
+	commits  map[ObjectID]*Commit
+	origins  map[blameOriginKey]*BlameOrigin
+	byCommit map[ObjectID][]*BlameOrigin
+	lines    map[*BlameOrigin][]string
+	suspects map[*BlameOrigin][]blameSuspect
+	queue    commitQueue
+	guilty   []BlameEntry
+}
+
+func (sb *blameScoreboard) openCommit(hash ObjectID) (*Commit, error) {
+	if commit, ok := sb.commits[hash]; ok {
+		return commit, nil
+	}
+
+	commit, err := sb.repo.OpenCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+	sb.commits[hash] = commit
+
+	return commit, nil
+}
+
+// getOrigin returns the origin for a path at a commit, creating it if needed
+func (sb *blameScoreboard) getOrigin(commit *Commit, path string, hash ObjectID, mode int) *BlameOrigin {
+	key := blameOriginKey{commit: commit.Hash, path: path}
+	if origin, ok := sb.origins[key]; ok {
+		return origin
+	}
+
+	origin := &BlameOrigin{Commit: commit, Path: path, Hash: hash, Mode: mode}
+	sb.origins[key] = origin
+	sb.byCommit[commit.Hash] = append(sb.byCommit[commit.Hash], origin)
+
+	return origin
+}
+
+func (sb *blameScoreboard) readLines(origin *BlameOrigin) ([]string, error) {
+	if lines, ok := sb.lines[origin]; ok {
+		return lines, nil
+	}
+
+	content, err := sb.repo.readChangeContent(origin.Hash, origin.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := SplitLines(content)
+	sb.lines[origin] = lines
+
+	return lines, nil
+}
+
+// suspect adds lines an origin is suspected of, queuing its commit if it had none
+func (sb *blameScoreboard) suspect(origin *BlameOrigin, suspects ...blameSuspect) {
+	if len(suspects) == 0 {
+		return
+	}
+
+	if len(sb.suspects[origin]) == 0 {
+		sb.queue.PushCommit(origin.Commit)
+	}
+	sb.suspects[origin] = append(sb.suspects[origin], suspects...)
+}
+
+// findOrigin returns the version of the origin's file in a parent, under the same path, if any
+func (sb *blameScoreboard) findOrigin(parent *Commit, origin *BlameOrigin) (*BlameOrigin, error) {
+	entry, err := sb.repo.LookupPath(parent.Tree, origin.Path)
+	if errors.Is(err, ErrPathNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// as with a type change, the file is considered as added
+	if modeKind(entry.Mode) != modeKind(origin.Mode) {
+		return nil, nil
+	}
+
+	return sb.getOrigin(parent, origin.Path, entry.Hash, entry.Mode), nil
+}
+
+// findRename returns the file of a parent which was renamed into the origin's file, if any
+func (sb *blameScoreboard) findRename(parent *Commit, origin *BlameOrigin) (*BlameOrigin, error) {
+	changes, err := sb.repo.DiffTrees(parent.Tree, origin.Commit.Tree, &DiffOptions{DetectRenames: true})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		if change.Type == CHANGE_RENAMED && change.NewPath == origin.Path {
+			return sb.getOrigin(parent, change.OldPath, change.OldHash, change.OldMode), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// passBlame passes the lines an origin is suspected of to its parents when they are unchanged. Remaining ones are
+// left to the origin. If a parent has the very same file, all lines are passed to it.
+func (sb *blameScoreboard) passBlame(origin *BlameOrigin) error {
+	parents := make([]*BlameOrigin, len(origin.Commit.Parents))
+
+	passes := 1
+	if sb.options.FollowRenames {
+		passes = 2
+	}
+
+	for pass := 0; pass < passes; pass++ {
+		for n, parentHash := range origin.Commit.Parents {
+			if parents[n] != nil {
+				continue
+			}
+
+			parent, err := sb.openCommit(parentHash)
+			if err != nil {
+				return err
+			}
+
+			var parentOrigin *BlameOrigin
+			if pass == 0 {
+				parentOrigin, err = sb.findOrigin(parent, origin)
+			} else {
+				parentOrigin, err = sb.findRename(parent, origin)
+			}
+			if err != nil {
+				return err
+			}
+			if parentOrigin == nil {
+				continue
+			}
+
+			if parentOrigin.Hash == origin.Hash {
+				suspects := sb.suspects[origin]
+				delete(sb.suspects, origin)
+				sb.suspect(parentOrigin, suspects...)
+				return nil
+			}
+
+			// a parent with the same version of the file as a previous one would not be given any line
+			same := false
+			for _, previous := range parents[:n] {
+				if previous != nil && previous.Hash == parentOrigin.Hash {
+					same = true
+					break
+				}
+			}
+			if !same {
+				parents[n] = parentOrigin
+			}
+		}
+	}
+
+	for _, parentOrigin := range parents {
+		if parentOrigin == nil {
+			continue
+		}
+
+		if origin.Previous == nil {
+			origin.Previous = parentOrigin
+		}
+
+		if err := sb.passToParent(origin, parentOrigin); err != nil {
+			return err
+		}
+
+		if len(sb.suspects[origin]) == 0 {
+			break
+		}
+	}
+
+	return nil
+}
+
+// passToParent passes the lines an origin is suspected of to a parent, for the ones unchanged between them
+func (sb *blameScoreboard) passToParent(origin, parentOrigin *BlameOrigin) error {
+	lines, err := sb.readLines(origin)
+	if err != nil {
+		return err
+	}
+	parentLines, err := sb.readLines(parentOrigin)
+	if err != nil {
+		return err
+	}
+
+	// unchanged ranges of lines, between changes
+	type unchanged struct {
+		start, count, parentStart int
+	}
+	ranges := make([]unchanged, 0)
+
+	changes := DiffLines(parentLines, lines, sb.options.Algorithm)
+	changes = append(changes, LineChange{OldStart: len(parentLines), NewStart: len(lines)})
+
+	parentPos, pos := 0, 0
+	for _, change := range changes {
+		if change.NewStart > pos {
+			ranges = append(ranges, unchanged{start: pos, count: change.NewStart - pos, parentStart: parentPos})
+		}
+		parentPos, pos = change.OldStart+change.OldCount, change.NewStart+change.NewCount
+	}
+
+	kept := make([]blameSuspect, 0)
+	passed := make([]blameSuspect, 0)
+
+	for _, suspect := range sb.suspects[origin] {
+		pos, end := suspect.orig, suspect.orig+suspect.count
+
+		for _, r := range ranges {
+			from, to := max(pos, r.start), min(end, r.start+r.count)
+			if from >= to {
+				continue
+			}
+
+			if from > pos {
+				kept = append(kept, blameSuspect{start: suspect.start + pos - suspect.orig, count: from - pos, orig: pos})
+			}
+			passed = append(passed, blameSuspect{
+				start: suspect.start + from - suspect.orig,
+				count: to - from,
+				orig:  r.parentStart + from - r.start,
+			})
+			pos = to
+		}
+
+		if pos < end {
+			kept = append(kept, blameSuspect{start: suspect.start + pos - suspect.orig, count: end - pos, orig: pos})
+		}
+	}
+
+	sb.suspects[origin] = kept
+	sb.suspect(parentOrigin, passed...)
+
+	return nil
+}
+
+// Blame attributes each line of a file at a revision to the commit which introduced it, walking the history from
+// the most recent commits. options can be nil for the defaults: renames are followed.
+func (repo Repository) Blame(rev, path string, options *BlameOptions) (*FileBlame, error) {
+	if options == nil {
+		options = &BlameOptions{FollowRenames: true}
+	}
+
+	path = strings.Trim(path, "/")
+
+	hash, err := repo.ResolveRevision(rev + "^{commit}")
+	if err != nil {
+		return nil, err
+	}
+
+	sb := &blameScoreboard{
+		repo:     repo,
+		options:  options,
+		commits:  make(map[ObjectID]*Commit),
+		origins:  make(map[blameOriginKey]*BlameOrigin),
+		byCommit: make(map[ObjectID][]*BlameOrigin),
+		lines:    make(map[*BlameOrigin][]string),
+		suspects: make(map[*BlameOrigin][]blameSuspect),
+		guilty:   make([]BlameEntry, 0),
+	}
+
+	commit, err := sb.openCommit(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	entry, err := repo.LookupPath(commit.Tree, path)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Kind == TREE_ENTRY_TREE {
+		return nil, fmt.Errorf("%s is a directory in %s", path, rev)
+	}
+
+	final := sb.getOrigin(commit, path, entry.Hash, entry.Mode)
+	lines, err := sb.readLines(final)
+	if err != nil {
+		return nil, err
+	}
+
+	sb.suspect(final, blameSuspect{start: 0, count: len(lines), orig: 0})
+
+	for sb.queue.Len() > 0 {
+		commit := sb.queue.PopCommit()
+
+		for _, origin := range sb.byCommit[commit.Hash] {
+			if len(sb.suspects[origin]) == 0 {
+				continue
+			}
+
+			if err := sb.passBlame(origin); err != nil {
+				return nil, err
+			}
+
+			// the origin takes responsibility for the lines left
+			for _, suspect := range sb.suspects[origin] {
+				sb.guilty = append(sb.guilty, BlameEntry{
+					Origin:     origin,
+					OrigStart:  suspect.orig + 1,
+					FinalStart: suspect.start + 1,
+					Count:      suspect.count,
+				})
+			}
+			delete(sb.suspects, origin)
+		}
+	}
+
+	sort.Slice(sb.guilty, func(i, j int) bool {
+		return sb.guilty[i].FinalStart < sb.guilty[j].FinalStart
+	})
+
+	entries := make([]BlameEntry, 0, len(sb.guilty))
+	for _, entry := range sb.guilty {
+		if len(entries) > 0 {
+			last := &entries[len(entries)-1]
+			if last.Origin == entry.Origin && last.OrigStart+last.Count == entry.OrigStart &&
+				last.FinalStart+last.Count == entry.FinalStart {
+				last.Count += entry.Count
+				continue
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return &FileBlame{Path: path, Lines: lines, Entries: entries}, nil
+}
@@ -0,0 +1,92 @@
+package git
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+// writeBlameHistory writes a history of random edits of a file, renamed on the way, with a merge of a side branch
+// whose lines are kept. It returns the name of the last commit.
+func writeBlameHistory(repo *testRepo, seed uint64) string {
+	random := rand.New(rand.NewPCG(seed, seed))
+
+	name := fmt.Sprintf("s%d-", seed)
+	lines := randomLines(random, 60)
+	repo.commitTree(name+"0", repo.tree(map[string]string{"file.go": strings.Join(lines, "")}), 1000)
+
+	for n := 1; n < 3; n++ {
+		lines = editLines(random, lines)
+		files := map[string]string{"file.go": strings.Join(lines, ""), "other": fmt.Sprint(n)}
+		repo.commitTree(fmt.Sprintf("%s%d", name, n), repo.tree(files), int64(1000+n), fmt.Sprintf("%s%d", name, n-1))
+	}
+
+	sideLines := editLines(random, lines)
+	repo.commitTree(name+"side", repo.tree(map[string]string{"file.go": strings.Join(sideLines, "")}), 1003, name+"2")
+
+	lines = editLines(random, lines)
+	repo.commitTree(name+"renamed", repo.tree(map[string]string{"renamed.go": strings.Join(lines, "")}), 1004, name+"2")
+
+	at := random.IntN(len(lines) + 1)
+	lines = append(append(append([]string{}, lines[:at]...), sideLines[len(sideLines)/2:]...), lines[at:]...)
+	repo.commitTree(name+"merge", repo.tree(map[string]string{"renamed.go": strings.Join(lines, "")}), 1005,
+		name+"renamed", name+"side")
+
+	lines = editLines(random, lines)
+	repo.commitTree(name+"last", repo.tree(map[string]string{"renamed.go": strings.Join(lines, "")}), 1006, name+"merge")
+
+	return name + "last"
+}
+
+func TestBlame(t *testing.T) {
+	repo := newTestRepo(t)
+	revs := make([]string, 0)
+	for seed := range uint64(10) {
+		revs = append(revs, writeBlameHistory(repo, seed))
+	}
+	repository := repo.open(false)
+
+	for _, rev := range revs {
+		blame, err := repository.Blame(rev, "renamed.go", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// each line's commit, line numbers, file name, previous version and boundary flag, as in --line-porcelain
+		got := make([]string, 0, len(blame.Lines))
+		for _, entry := range blame.Entries {
+			for n := range entry.Count {
+				line := fmt.Sprintf("%s %d %d", entry.Origin.Commit.Hash, entry.OrigStart+n, entry.FinalStart+n)
+				if n == 0 {
+					line += fmt.Sprintf(" %d", entry.Count)
+				}
+				if entry.Origin.IsBoundary() {
+					line += " boundary"
+				}
+				if entry.Origin.Previous != nil {
+					line += fmt.Sprintf(" previous %s %s", entry.Origin.Previous.Commit.Hash, entry.Origin.Previous.Path)
+				}
+				got = append(got, line+" filename "+entry.Origin.Path)
+			}
+		}
+
+		expected := make([]string, 0, len(blame.Lines))
+		for _, line := range strings.Split(repo.git(nil, "blame", "--line-porcelain", rev, "--", "renamed.go"), "\n") {
+			switch field, value, _ := strings.Cut(line, " "); field {
+			case "boundary":
+				expected[len(expected)-1] += " boundary"
+			case "previous", "filename":
+				expected[len(expected)-1] += " " + field + " " + value
+			default:
+				if len(field) == repository.ObjectFormat.Size()*2 {
+					expected = append(expected, line)
+				}
+			}
+		}
+
+		if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("blame %s:\n%s\nexpected:\n%s", rev, strings.Join(got, "\n"), strings.Join(expected, "\n"))
+		}
+	}
+}
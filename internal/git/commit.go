@@ -0,0 +1,261 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signature is the identity of an author, committer or tagger, along with the time of the action
+type Signature struct {
+	Name  string
+	Email string
+	When  time.Time
+}
+
+// CommitHeader is a commit header not otherwise parsed (mergetag, gpgsig...). Its value may span multiple lines.
+type CommitHeader struct {
+	Key   string
+	Value string
+}
+
+type Commit struct {
+	Hash         ObjectID
+	Tree         ObjectID
+	Parents      []ObjectID
+	Author       Signature
+	Committer    Signature
+	Encoding     string
+	ExtraHeaders []CommitHeader
+	Message      string
+
+	Generation uint64 // generation number from the commit-graph, 0 if unknown
+	Partial    bool   // only hash, tree, parents, commit date and generation are set, as read from the commit-graph
+}
+
+// ParseSignature parses an identity line such as "John Doe <john@doe.com> 1721423268 +0200"
+func ParseSignature(line string) (Signature, error) {
+	emailStart := strings.IndexByte(line, '<')
+	emailEnd := strings.IndexByte(line, '>')
+	if emailStart < 0 || emailEnd < emailStart {
+		return Signature{}, fmt.Errorf("invalid signature: %s", line)
+	}
+
+	signature := Signature{
+		Name:  strings.TrimSpace(line[:emailStart]),
+		Email: line[emailStart+1 : emailEnd],
+	}
+
+	parts := strings.Fields(line[emailEnd+1:])
+	if len(parts) != 2 {
+		return Signature{}, fmt.Errorf("invalid signature date: %s", line)
+	}
+
+	timestamp, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Signature{}, fmt.Errorf("invalid signature timestamp: %s", line)
+	}
+
+	zone := parts[1]
+	if len(zone) != 5 || (zone[0] != '+' && zone[0] != '-') {
+		return Signature{}, fmt.Errorf("invalid signature timezone: %s", line)
+	}
+
+	hours, err := strconv.Atoi(zone[1:3])
+	if err != nil {
+		return Signature{}, fmt.Errorf("invalid signature timezone: %s", line)
+	}
+	minutes, err := strconv.Atoi(zone[3:5])
+	if err != nil {
+		return Signature{}, fmt.Errorf("invalid signature timezone: %s", line)
+	}
+
+	offset := hours*3600 + minutes*60
+	if zone[0] == '-' {
+		offset = -offset
+	}
+
+	signature.When = time.Unix(timestamp, 0).In(time.FixedZone(zone, offset))
+
+	return signature, nil
+}
+
+func (s Signature) String() string {
+	if s.Name == "" {
+		return fmt.Sprintf("<%s> %d %s", s.Email, s.When.Unix(), s.When.Format("-0700"))
+	}
+
+	return fmt.Sprintf("%s <%s> %d %s", s.Name, s.Email, s.When.Unix(), s.When.Format("-0700"))
+}
+
+// parseHeaders splits an object's contents into its headers, keeping their order, and its message. Continuation
+// lines (starting with a space) are appended to the previous header's value.
+func parseHeaders(data []byte) ([]CommitHeader, string, error) {
+	headers := make([]CommitHeader, 0)
+
+	for len(data) > 0 {
+		eol := bytes.IndexByte(data, '\n')
+		if eol < 0 {
+			eol = len(data)
+		}
+
+		line := string(data[:eol])
+		data = data[min(eol+1, len(data)):]
+
+		// an empty line separates headers from the message
+		if line == "" {
+			return headers, string(data), nil
+		}
+
+		if line[0] == ' ' {
+			if len(headers) == 0 {
+				return nil, "", fmt.Errorf("invalid header continuation line: %s", line)
+			}
+			headers[len(headers)-1].Value += "\n" + line[1:]
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, " ")
+		headers = append(headers, CommitHeader{Key: key, Value: value})
+	}
+
+	return headers, "", nil
+}
+
+// ParseCommit parses a commit object's contents
+func ParseCommit(data []byte) (*Commit, error) {
+	headers, message, err := parseHeaders(data)
+	if err != nil {
+		return nil, err
+	}
+
+	commit := &Commit{
+		Parents:      make([]ObjectID, 0),
+		ExtraHeaders: make([]CommitHeader, 0),
+		Message:      message,
+	}
+
+	for _, header := range headers {
+		switch header.Key {
+		case "tree":
+			if commit.Tree, err = ParseObjectID(header.Value); err != nil {
+				return nil, fmt.Errorf("invalid commit tree: %w", err)
+			}
+		case "parent":
+			parent, err := ParseObjectID(header.Value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid commit parent: %w", err)
+			}
+			commit.Parents = append(commit.Parents, parent)
+		case "author":
+			if commit.Author, err = ParseSignature(header.Value); err != nil {
+				return nil, err
+			}
+		case "committer":
+			if commit.Committer, err = ParseSignature(header.Value); err != nil {
+				return nil, err
+			}
+		case "encoding":
+			commit.Encoding = header.Value
+		default:
+			commit.ExtraHeaders = append(commit.ExtraHeaders, header)
+		}
+	}
+
+	if commit.Tree.IsZero() {
+		return nil, fmt.Errorf("invalid commit: missing tree")
+	}
+
+	return commit, nil
+}
+
+// OpenCommit opens a commit object by its hash and parses it
+func (repo Repository) OpenCommit(hash ObjectID) (*Commit, error) {
+	object, err := repo.OpenObject(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if object, err = repo.ApplyDelta(object); err != nil {
+		return nil, err
+	}
+	if object.Type != OBJECT_TYPE_COMMIT {
+		return nil, fmt.Errorf("object %s is a %s, not a commit", hash, object.Type)
+	}
+
+	commit, err := ParseCommit(object.Content)
+	if err != nil {
+		return nil, err
+	}
+	commit.Hash = hash
+
+	if repo.CommitGraph != nil {
+		if graphCommit, ok, err := repo.CommitGraph.Lookup(hash); err == nil && ok {
+			commit.Generation = graphCommit.Generation
+		}
+	}
+
+	return commit, nil
+}
+
+// openGraphCommit returns the partial commit from the commit-graph, if any, so walking the history does not require
+// inflating commits; otherwise the commit is opened and parsed
+func (repo Repository) openGraphCommit(hash ObjectID) (*Commit, error) {
+	if repo.CommitGraph != nil {
+		commit, ok, err := repo.CommitGraph.Lookup(hash)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return commit, nil
+		}
+	}
+
+	return repo.OpenCommit(hash)
+}
+
+// GetHeader returns the value of the first extra header with the given key
+func (commit *Commit) GetHeader(key string) (string, bool) {
+	for _, header := range commit.ExtraHeaders {
+		if header.Key == key {
+			return header.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// Title returns the first line of the commit's message
+func (commit *Commit) Title() string {
+	title, _, _ := strings.Cut(commit.Message, "\n")
+	return title
+}
+
+func writeHeader(out *strings.Builder, key, value string) {
+	fmt.Fprintf(out, "%s %s\n", key, strings.ReplaceAll(value, "\n", "\n "))
+}
+
+// String returns the commit in its canonical form, as stored in the object
+func (commit *Commit) String() string {
+	out := strings.Builder{}
+
+	writeHeader(&out, "tree", commit.Tree.String())
+	for _, parent := range commit.Parents {
+		writeHeader(&out, "parent", parent.String())
+	}
+	writeHeader(&out, "author", commit.Author.String())
+	writeHeader(&out, "committer", commit.Committer.String())
+	if commit.Encoding != "" {
+		writeHeader(&out, "encoding", commit.Encoding)
+	}
+	for _, header := range commit.ExtraHeaders {
+		writeHeader(&out, header.Key, header.Value)
+	}
+
+	out.WriteString("\n")
+	out.WriteString(commit.Message)
+
+	return out.String()
+}
@@ -0,0 +1,290 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+)
+
+const (
+	COMMIT_GRAPH_CHUNK_OID_FANOUT          = "OIDF"
+	COMMIT_GRAPH_CHUNK_OID_LOOKUP          = "OIDL"
+	COMMIT_GRAPH_CHUNK_COMMIT_DATA         = "CDAT"
+	COMMIT_GRAPH_CHUNK_GENERATION_DATA     = "GDA2"
+	COMMIT_GRAPH_CHUNK_GENERATION_OVERFLOW = "GDO2"
+	COMMIT_GRAPH_CHUNK_EXTRA_EDGES         = "EDGE"
+
+	COMMIT_GRAPH_PARENT_NONE = 0x70000000
+)
+
+// commitGraphLayer is a single commit-graph file, either the only one or one of a split chain
+type commitGraphLayer struct {
+	Fanout             [256]uint32
+	format             ObjectFormat
+	hashes             []byte
+	commitData         []byte
+	extraEdges         []byte
+	generationData     []byte
+	generationOverflow []byte
+	base               uint32 // number of commits in the layers below this one
+}
+
+// CommitGraph is a parsed "<repo>/.git/objects/info/commit-graph" file, or chain of files, holding the parents, root
+// tree, commit date and generation number of commits, so the history can be walked without inflating them
+type CommitGraph struct {
+	layers []*commitGraphLayer // base layer first
+	format ObjectFormat
+
+	// corrected commit dates are used as generation numbers only if all layers have them
+	generationV2 bool
+}
+
+func (repo Repository) GetCommitGraphPath() string {
+	return path.Join(repo.GetObjectsDir(), "info", "commit-graph")
+}
+
+func (repo Repository) GetCommitGraphChainPath() string {
+	return path.Join(repo.GetObjectsDir(), "info", "commit-graphs", "commit-graph-chain")
+}
+
+// OpenCommitGraph opens and parses the commit-graph file, or chain of files. It returns a nil graph if there is none.
+func (repo Repository) OpenCommitGraph() (*CommitGraph, error) {
+	files := []string{repo.GetCommitGraphPath()}
+
+	if _, err := os.Stat(files[0]); os.IsNotExist(err) {
+		chain, err := os.ReadFile(repo.GetCommitGraphChainPath())
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+
+		files = []string{}
+		for _, hash := range strings.Fields(string(chain)) {
+			files = append(files, path.Join(path.Dir(repo.GetCommitGraphChainPath()), fmt.Sprintf("graph-%s.graph", hash)))
+		}
+	}
+
+	graph := &CommitGraph{format: repo.ObjectFormat, generationV2: true}
+	base := uint32(0)
+
+	for n, file := range files {
+		layer, err := openCommitGraphLayer(file, n, repo.ObjectFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		layer.base = base
+		base += uint32(layer.Len())
+
+		if layer.generationData == nil {
+			graph.generationV2 = false
+		}
+
+		graph.layers = append(graph.layers, layer)
+	}
+
+	return graph, nil
+}
+
+// openCommitGraphLayer parses a single commit-graph file, which must have baseLayers layers below it
+func openCommitGraphLayer(file string, baseLayers int, format ObjectFormat) (*commitGraphLayer, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	hashSize := format.Size()
+
+	if len(data) < 8+hashSize || !reflect.DeepEqual(data[0:4], []byte("CGPH")) {
+		return nil, fmt.Errorf("invalid header for commit-graph %s", file)
+	}
+	if data[4] != 1 {
+		return nil, fmt.Errorf("%w for commit-graph %s: %d", ErrUnsupportedVersion, file, data[4])
+	}
+	if uint32(data[5]) != format.HashId() {
+		return nil, fmt.Errorf("unsupported hash function for commit-graph %s: %d", file, data[5])
+	}
+	if int(data[7]) != baseLayers {
+		return nil, fmt.Errorf("invalid base graphs count for commit-graph %s: %d != %d", file, data[7], baseLayers)
+	}
+
+	checksum := format.Sum(data[:len(data)-hashSize])
+	if !bytes.Equal(checksum.Bytes(), data[len(data)-hashSize:]) {
+		return nil, fmt.Errorf("invalid checksum for commit-graph %s", file)
+	}
+
+	chunks, err := readChunks(data, 8, int(data[6]))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chunkId := range []string{COMMIT_GRAPH_CHUNK_OID_FANOUT, COMMIT_GRAPH_CHUNK_OID_LOOKUP, COMMIT_GRAPH_CHUNK_COMMIT_DATA} {
+		if _, ok := chunks[chunkId]; !ok {
+			return nil, fmt.Errorf("missing %s chunk in commit-graph %s", chunkId, file)
+		}
+	}
+
+	layer := &commitGraphLayer{
+		commitData:         chunks[COMMIT_GRAPH_CHUNK_COMMIT_DATA],
+		extraEdges:         chunks[COMMIT_GRAPH_CHUNK_EXTRA_EDGES],
+		generationData:     chunks[COMMIT_GRAPH_CHUNK_GENERATION_DATA],
+		generationOverflow: chunks[COMMIT_GRAPH_CHUNK_GENERATION_OVERFLOW],
+	}
+
+	fanout := chunks[COMMIT_GRAPH_CHUNK_OID_FANOUT]
+	if len(fanout) != 256*4 {
+		return nil, fmt.Errorf("invalid %s chunk size in commit-graph %s", COMMIT_GRAPH_CHUNK_OID_FANOUT, file)
+	}
+	if layer.Fanout, err = readFanout(fanout); err != nil {
+		return nil, fmt.Errorf("%w in commit-graph %s", err, file)
+	}
+
+	entriesNum := int(layer.Fanout[255])
+
+	lookup := chunks[COMMIT_GRAPH_CHUNK_OID_LOOKUP]
+	if len(lookup) != entriesNum*hashSize || len(layer.commitData) != entriesNum*(hashSize+16) {
+		return nil, fmt.Errorf("invalid chunk sizes in commit-graph %s", file)
+	}
+	if layer.generationData != nil && len(layer.generationData) != entriesNum*4 {
+		return nil, fmt.Errorf("invalid %s chunk size in commit-graph %s", COMMIT_GRAPH_CHUNK_GENERATION_DATA, file)
+	}
+
+	layer.format = format
+	layer.hashes = lookup
+
+	return layer, nil
+}
+
+// Len returns the number of commits in the layer
+func (layer *commitGraphLayer) Len() int {
+	return int(layer.Fanout[255])
+}
+
+func (layer *commitGraphLayer) hashBytes(n int) []byte {
+	hashSize := layer.format.Size()
+	return layer.hashes[n*hashSize : (n+1)*hashSize]
+}
+
+// position returns the global position of a commit in the graph
+func (graph *CommitGraph) position(hash ObjectID) (uint32, bool) {
+	for _, layer := range graph.layers {
+		if n, ok := searchFanout(&layer.Fanout, hash, layer.hashBytes); ok {
+			return layer.base + uint32(n), true
+		}
+	}
+
+	return 0, false
+}
+
+// layerAt returns the layer holding the commit at the given global position, and its position in that layer
+func (graph *CommitGraph) layerAt(position uint32) (*commitGraphLayer, int, error) {
+	for _, layer := range graph.layers {
+		if position >= layer.base && position < layer.base+uint32(layer.Len()) {
+			return layer, int(position - layer.base), nil
+		}
+	}
+
+	return nil, 0, fmt.Errorf("invalid commit-graph position: %d", position)
+}
+
+func (graph *CommitGraph) hashAt(position uint32) (ObjectID, error) {
+	layer, n, err := graph.layerAt(position)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	return NewObjectID(layer.format, layer.hashBytes(n))
+}
+
+// Lookup returns a partial commit, with its hash, tree, parents, commit date and generation number, if the commit is
+// in the graph
+func (graph *CommitGraph) Lookup(hash ObjectID) (*Commit, bool, error) {
+	position, ok := graph.position(hash)
+	if !ok {
+		return nil, false, nil
+	}
+
+	layer, n, err := graph.layerAt(position)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hashSize := graph.format.Size()
+	data := layer.commitData[n*(hashSize+16):]
+
+	tree, err := NewObjectID(graph.format, data[:hashSize])
+	if err != nil {
+		return nil, false, err
+	}
+
+	commit := &Commit{
+		Hash:    hash,
+		Tree:    tree,
+		Parents: make([]ObjectID, 0),
+		Partial: true,
+	}
+
+	// first parent, then either second parent or, if the MSB is set, an index in the extra edges list, where the
+	// last parent has its MSB set
+	for _, parentPosition := range []uint32{binary.BigEndian.Uint32(data[hashSize:]), binary.BigEndian.Uint32(data[hashSize+4:])} {
+		if parentPosition == COMMIT_GRAPH_PARENT_NONE {
+			break
+		}
+
+		if parentPosition&0x80000000 != 0 {
+			for edge := int(parentPosition & 0x7fffffff); ; edge++ {
+				if len(layer.extraEdges) < (edge+1)*4 {
+					return nil, false, fmt.Errorf("invalid extra edge in commit-graph: %d", edge)
+				}
+
+				edgePosition := binary.BigEndian.Uint32(layer.extraEdges[edge*4:])
+
+				parent, err := graph.hashAt(edgePosition & 0x7fffffff)
+				if err != nil {
+					return nil, false, err
+				}
+				commit.Parents = append(commit.Parents, parent)
+
+				if edgePosition&0x80000000 != 0 {
+					break
+				}
+			}
+			break
+		}
+
+		parent, err := graph.hashAt(parentPosition)
+		if err != nil {
+			return nil, false, err
+		}
+		commit.Parents = append(commit.Parents, parent)
+	}
+
+	// 30 bits of topological level, then 34 bits of commit date
+	levelAndDate := binary.BigEndian.Uint64(data[hashSize+8:])
+	commitDate := levelAndDate & 0x3ffffffff
+	commit.Committer.When = time.Unix(int64(commitDate), 0)
+	commit.Generation = levelAndDate >> 34
+
+	// corrected commit dates are stored as offsets from the commit date; when the MSB is set, the offset is in the
+	// overflow list
+	if graph.generationV2 {
+		offset := uint64(binary.BigEndian.Uint32(layer.generationData[n*4:]))
+		if offset&0x80000000 != 0 {
+			overflow := int(offset & 0x7fffffff)
+			if len(layer.generationOverflow) < (overflow+1)*8 {
+				return nil, false, fmt.Errorf("invalid generation overflow in commit-graph: %d", overflow)
+			}
+			offset = binary.BigEndian.Uint64(layer.generationOverflow[overflow*8:])
+		}
+		commit.Generation = commitDate + offset
+	}
+
+	return commit, true, nil
+}
@@ -0,0 +1,152 @@
+package git
+
+import (
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeSplitCommitGraph writes a history in three steps, each adding a layer to a split commit-graph chain. It has
+// an octopus merge, whose parents are in the extra edges list, and commits dated before their parents.
+func writeSplitCommitGraph(repo *testRepo) {
+	repo.commit("a", 1000)
+	repo.commit("b", 1010, "a")
+	repo.commit("side", 1005, "a")
+	repo.git(nil, "commit-graph", "write", "--reachable", "--split=no-merge")
+
+	repo.commit("c", 900, "b")
+	repo.commit("third", 1020, "a")
+	repo.commit("octopus", 1030, "c", "side", "third")
+	repo.git(nil, "commit-graph", "write", "--reachable", "--split=no-merge")
+
+	repo.commit("d", 1040, "octopus")
+	repo.commit("e", 500, "d")
+	repo.commit("merge", 1050, "e", "side")
+	repo.git(nil, "commit-graph", "write", "--reachable", "--split=no-merge")
+}
+
+func TestCommitGraphChain(t *testing.T) {
+	repo := newTestRepo(t)
+	writeSplitCommitGraph(repo)
+	repository := repo.open(false)
+
+	chain, err := os.ReadFile(repository.GetCommitGraphChainPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layers := len(strings.Fields(string(chain))); layers != 3 {
+		t.Fatalf("the commit-graph chain has %d layers, expected 3", layers)
+	}
+
+	graph := repository.CommitGraph
+	if graph == nil {
+		t.Fatal("the commit-graph was not opened")
+	}
+
+	// generations are corrected commit dates: at least the commit's date, and later than its parents'
+	generations := make(map[ObjectID]uint64)
+	var generation func(commit *Commit) uint64
+	generation = func(commit *Commit) uint64 {
+		if value, ok := generations[commit.Hash]; ok {
+			return value
+		}
+
+		value := uint64(commit.Committer.When.Unix())
+		for _, hash := range commit.Parents {
+			parent, err := repository.OpenCommit(hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			value = max(value, generation(parent)+1)
+		}
+
+		generations[commit.Hash] = value
+		return value
+	}
+
+	for name, hexHash := range repo.commits {
+		hash, _ := ParseObjectID(hexHash)
+
+		expected, err := repository.OpenCommit(hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		commit, ok, err := graph.Lookup(hash)
+		if err != nil || !ok {
+			t.Fatalf("%s not found in the commit-graph: %v", name, err)
+		}
+
+		if commit.Tree != expected.Tree || !slices.Equal(commit.Parents, expected.Parents) ||
+			!commit.Committer.When.Equal(expected.Committer.When) || commit.Generation != generation(expected) {
+			t.Errorf("%s: commit-graph has tree %s, parents %v, date %v, generation %d; expected %s, %v, %v, %d", name,
+				commit.Tree, repo.names(commit.Parents), commit.Committer.When.Unix(), commit.Generation,
+				expected.Tree, repo.names(expected.Parents), expected.Committer.When.Unix(), generation(expected))
+		}
+	}
+
+	for _, order := range walkOrders {
+		walk := repository.NewRevWalk()
+		walk.Sort = order.sort
+		if err := walk.Push("merge"); err != nil {
+			t.Fatal(err)
+		}
+
+		commits, err := walk.Commits()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		hashes := make([]ObjectID, 0, len(commits))
+		for _, commit := range commits {
+			hashes = append(hashes, commit.Hash)
+		}
+
+		expected := strings.Split(repo.git(nil, append(append([]string{"rev-list"}, order.args...), "merge")...), "\n")
+		expectedHashes := make([]ObjectID, 0, len(expected))
+		for _, hexHash := range expected {
+			hash, _ := ParseObjectID(hexHash)
+			expectedHashes = append(expectedHashes, hash)
+		}
+
+		if got, want := repo.names(hashes), repo.names(expectedHashes); !slices.Equal(got, want) {
+			t.Errorf("rev-list %s merge = %v, expected %v", strings.Join(order.args, " "), got, want)
+		}
+	}
+}
+
+func TestCommitGraphChecksum(t *testing.T) {
+	repo := newTestRepo(t)
+	writeSplitCommitGraph(repo)
+	repository := repo.open(false)
+
+	chain, err := os.ReadFile(repository.GetCommitGraphChainPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a byte in the middle of the second layer is changed
+	layer := "graph-" + strings.Fields(string(chain))[1] + ".graph"
+	layerPath := path.Join(path.Dir(repository.GetCommitGraphChainPath()), layer)
+	data, err := os.ReadFile(layerPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+
+	if err := os.Remove(layerPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(layerPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if graph, err := repository.OpenCommitGraph(); err == nil {
+		t.Errorf("OpenCommitGraph returned %v, expected a checksum error", graph)
+	}
+	if repository = repo.open(false); repository.CommitGraph != nil {
+		t.Error("an invalid commit-graph was opened")
+	}
+}
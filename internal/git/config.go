@@ -0,0 +1,91 @@
+package git
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"strings"
+)
+
+// GetConfigValue returns the value of a variable of "<repo>/.git/config", given as "section.key". Subsections are
+// not supported. As with git, the last value wins; false is returned if the variable is not set.
+func (repo Repository) GetConfigValue(name string) (string, bool, error) {
+	section, key, ok := strings.Cut(strings.ToLower(name), ".")
+	if !ok {
+		return "", false, nil
+	}
+
+	fileFD, err := os.Open(path.Join(repo.GetGitDir(), "config"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	defer fileFD.Close()
+
+	value, found := "", false
+	currentSection := ""
+
+	scanner := bufio.NewScanner(fileFD)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				continue
+			}
+			currentSection = strings.ToLower(strings.TrimSpace(line[1:end]))
+			line = strings.TrimSpace(line[end+1:])
+			if line == "" {
+				continue
+			}
+		}
+
+		if currentSection != section {
+			continue
+		}
+
+		lineKey, lineValue, hasValue := strings.Cut(line, "=")
+		if strings.ToLower(strings.TrimSpace(lineKey)) != key {
+			continue
+		}
+
+		// a key without value is a true boolean
+		value, found = "true", true
+		if hasValue {
+			value = parseConfigValue(lineValue)
+		}
+	}
+
+	return value, found, scanner.Err()
+}
+
+// parseConfigValue removes comments, surrounding spaces and quotes from a value
+func parseConfigValue(raw string) string {
+	var value strings.Builder
+	quoted := false
+
+	for n := 0; n < len(raw); n++ {
+		c := raw[n]
+
+		switch {
+		case c == '"':
+			quoted = !quoted
+		case c == '\\' && n+1 < len(raw):
+			n++
+			value.WriteByte(raw[n])
+		case (c == '#' || c == ';') && !quoted:
+			return strings.TrimSpace(value.String())
+		default:
+			value.WriteByte(c)
+		}
+	}
+
+	return strings.TrimSpace(value.String())
+}
@@ -0,0 +1,119 @@
+package git
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// default maximum size of the delta base cache, as git's core.deltaBaseCacheLimit
+	DEFAULT_DELTA_BASE_CACHE_SIZE = 96 * 1024 * 1024
+)
+
+type deltaBaseKey struct {
+	pack   string
+	offset int64
+}
+
+type deltaBaseEntry struct {
+	key    deltaBaseKey
+	object Object
+}
+
+// DeltaBaseCache is a least recently used cache of delta bases, once inflated and with their own deltas applied,
+// keyed by pack & offset. Objects are evicted once their total size exceeds MaxSize. A nil cache caches nothing.
+// The cache is shared by copies of a repository, and can be used from several goroutines.
+type DeltaBaseCache struct {
+	MaxSize int64
+	Hits    atomic.Int64
+	Misses  atomic.Int64
+
+	mu      sync.Mutex // guards the fields below
+	size    int64
+	entries map[deltaBaseKey]*list.Element
+	lru     *list.List // most recently used first
+}
+
+// NewDeltaBaseCache returns an empty cache, holding objects up to maxSize bytes
+func NewDeltaBaseCache(maxSize int64) *DeltaBaseCache {
+	return &DeltaBaseCache{
+		MaxSize: maxSize,
+		entries: make(map[deltaBaseKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// Get returns the object at an offset of a pack, if cached
+func (cache *DeltaBaseCache) Get(pack string, offset int64) (Object, bool) {
+	if cache == nil {
+		return Object{}, false
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	element, ok := cache.entries[deltaBaseKey{pack, offset}]
+	if !ok {
+		cache.Misses.Add(1)
+		return Object{}, false
+	}
+
+	cache.Hits.Add(1)
+	cache.lru.MoveToFront(element)
+
+	return element.Value.(*deltaBaseEntry).object, true
+}
+
+// Add caches the object at an offset of a pack, evicting the least recently used ones if needed. Objects larger than
+// the cache are not cached.
+func (cache *DeltaBaseCache) Add(pack string, offset int64, object Object) {
+	if cache == nil || int64(len(object.Content)) > cache.MaxSize {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	key := deltaBaseKey{pack, offset}
+	if element, ok := cache.entries[key]; ok {
+		cache.lru.MoveToFront(element)
+		return
+	}
+
+	cache.entries[key] = cache.lru.PushFront(&deltaBaseEntry{key: key, object: object})
+	cache.size += int64(len(object.Content))
+
+	for cache.size > cache.MaxSize {
+		oldest := cache.lru.Back()
+		entry := oldest.Value.(*deltaBaseEntry)
+
+		cache.lru.Remove(oldest)
+		delete(cache.entries, entry.key)
+		cache.size -= int64(len(entry.object.Content))
+	}
+}
+
+// Len returns the number of cached objects
+func (cache *DeltaBaseCache) Len() int {
+	if cache == nil {
+		return 0
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.lru.Len()
+}
+
+// Size returns the total size of cached objects
+func (cache *DeltaBaseCache) Size() int64 {
+	if cache == nil {
+		return 0
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	return cache.size
+}
@@ -0,0 +1,90 @@
+package git
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestDeltaBaseCacheConcurrency applies deltas from several goroutines sharing a repository's cache. Run with -race.
+func TestDeltaBaseCacheConcurrency(t *testing.T) {
+	base := []byte("hello, world\n")
+	delta := appendVariantIntegerLE(appendVariantIntegerLE(nil, uint64(len(base))), 11)
+	delta = append(delta, 0x80|0x10, 7, 4, 'g', 'i', 't', '\n')
+	deltaHash := blobHash([]byte("hello, git\n"))
+
+	repository := writeTestPack(t, []testPackObject{
+		{hash: blobHash(base), objectType: 3, size: len(base), content: base},
+		{hash: deltaHash, objectType: 6, size: len(delta), content: delta},
+	})
+
+	const goroutines, reads = 8, 100
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for range reads {
+				object, err := repository.OpenObject(deltaHash)
+				if err == nil {
+					object, err = repository.ApplyDelta(object)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+				if string(object.Content) != "hello, git\n" {
+					t.Errorf("ApplyDelta returned %q", object.Content)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	cache := repository.DeltaBaseCache
+	if hits, misses := cache.Hits.Load(), cache.Misses.Load(); hits+misses != goroutines*reads || misses == 0 {
+		t.Errorf("cache has %d hits and %d misses for %d reads", hits, misses, goroutines*reads)
+	}
+	if cache.Len() != 1 || cache.Size() != int64(len(base)) {
+		t.Errorf("cache holds %d objects, %d bytes", cache.Len(), cache.Size())
+	}
+}
+
+// TestDeltaBaseCacheEviction adds and gets objects from several goroutines, evicting them. Run with -race.
+func TestDeltaBaseCacheEviction(t *testing.T) {
+	const goroutines, objects = 8, 100
+
+	cache := NewDeltaBaseCache(10 * 13)
+	object := Object{Type: OBJECT_TYPE_BLOB, Content: []byte("hello, world\n")}
+
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for offset := range int64(objects) {
+				if _, ok := cache.Get("pack-test.pack", offset); !ok {
+					cache.Add("pack-test.pack", offset, object)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if cache.Len() != 10 || cache.Size() != 10*13 {
+		t.Errorf("cache holds %d objects, %d bytes", cache.Len(), cache.Size())
+	}
+	if hits, misses := cache.Hits.Load(), cache.Misses.Load(); hits+misses != goroutines*objects {
+		t.Errorf("cache has %d hits and %d misses for %d reads", hits, misses, goroutines*objects)
+	}
+}
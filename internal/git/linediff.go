@@ -0,0 +1,878 @@
+package git
+
+import (
+	"bytes"
+	"math"
+)
+
+type DiffAlgorithm int
+
+const (
+	DIFF_ALGORITHM_MYERS     DiffAlgorithm = iota // minimal edit script, with git's heuristics for large diffs
+	DIFF_ALGORITHM_HISTOGRAM                      // matches lines occurring the least first, falls back to Myers
+)
+
+const (
+	// contents with a NUL byte in their first bytes are considered binary, like git does
+	BINARY_CHECK_SIZE = 8000
+
+	// Myers heuristics, as in git's xdiff
+	MYERS_SNAKE_COUNT    = 20   // length of a diagonal run considered a good snake
+	MYERS_HEURISTIC_COST = 256  // edit cost from which good snakes are used to split the search
+	MYERS_MAX_COST_MIN   = 256  // minimum edit cost from which the search is cut short
+	MYERS_HEURISTIC_K    = 4    // ratio between the distance walked on a snake and the edit cost to use it
+	MYERS_MAX_EQ_LIMIT   = 1024 // number of occurrences from which a line is only weakly matched
+	MYERS_SIMSCAN_WINDOW = 100  // window of lines scanned around weakly matched lines
+	MYERS_KPDIS_RUN      = 4    // ratio of weakly matched lines in a run of unmatched lines to discard them
+
+	// the histogram diff falls back to Myers if all common lines occur more than this
+	HISTOGRAM_MAX_CHAIN_LENGTH = 64
+
+	// indent heuristic, as in git's xdiff: changes are slid to where their boundaries look the most natural
+	INDENT_MAX                         = 200
+	INDENT_MAX_BLANKS                  = 20
+	INDENT_MAX_SLIDING                 = 100
+	INDENT_START_OF_FILE_PENALTY       = 1
+	INDENT_END_OF_FILE_PENALTY         = 21
+	INDENT_TOTAL_BLANK_WEIGHT          = -30
+	INDENT_POST_BLANK_WEIGHT           = 6
+	INDENT_RELATIVE_INDENT_PENALTY     = -4
+	INDENT_RELATIVE_INDENT_WITH_BLANK  = 10
+	INDENT_RELATIVE_OUTDENT_PENALTY    = 24
+	INDENT_RELATIVE_OUTDENT_WITH_BLANK = 17
+	INDENT_RELATIVE_DEDENT_PENALTY     = 23
+	INDENT_RELATIVE_DEDENT_WITH_BLANK  = 17
+	INDENT_WEIGHT                      = 60
+)
+
+// LineChange is a run of changed lines: OldCount lines from OldStart in the old lines are replaced by NewCount lines
+// from NewStart in the new ones. Positions start at 0.
+type LineChange struct {
+	OldStart int
+	OldCount int
+	NewStart int
+	NewCount int
+}
+
+// IsBinary returns true if the content looks binary, i.e. has a NUL byte in its first bytes
+func IsBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), BINARY_CHECK_SIZE)], 0) != -1
+}
+
+// SplitLines splits content in lines, keeping their trailing newline. The last line has none if the content
+// doesn't end with a newline.
+func SplitLines(content []byte) []string {
+	lines := make([]string, 0, bytes.Count(content, []byte{'\n'})+1)
+
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		lines = append(lines, string(content[:end]))
+		content = content[end:]
+	}
+
+	return lines
+}
+
+// DiffLines returns the changes turning oldLines into newLines
+func DiffLines(oldLines, newLines []string, algorithm DiffAlgorithm) []LineChange {
+	// lines are compared by class, lines with the same content having the same class
+	classes := make(map[string]int)
+	classify := func(lines []string) []int {
+		ha := make([]int, len(lines))
+		for n, line := range lines {
+			class, ok := classes[line]
+			if !ok {
+				class = len(classes)
+				classes[line] = class
+			}
+			ha[n] = class
+		}
+		return ha
+	}
+
+	oldFile := newDiffFile(classify(oldLines))
+	newFile := newDiffFile(classify(newLines))
+
+	if algorithm == DIFF_ALGORITHM_HISTOGRAM {
+		histogramDiff(oldFile, newFile, 1, len(oldLines), 1, len(newLines))
+	} else {
+		myersDiff(oldFile, newFile, 0, len(oldLines), 0, len(newLines))
+	}
+
+	oldFile.compact(newFile, oldLines)
+	newFile.compact(oldFile, newLines)
+
+	changes := make([]LineChange, 0)
+	for i1, i2 := 0, 0; i1 < oldFile.nrec || i2 < newFile.nrec; {
+		if !oldFile.changed(i1) && !newFile.changed(i2) {
+			i1++
+			i2++
+			continue
+		}
+
+		change := LineChange{OldStart: i1, NewStart: i2}
+		for ; oldFile.changed(i1); i1++ {
+			change.OldCount++
+		}
+		for ; newFile.changed(i2); i2++ {
+			change.NewCount++
+		}
+		changes = append(changes, change)
+	}
+
+	return changes
+}
+
+// diffFile holds the line classes of one side of a diff, and which of its lines are changed
+type diffFile struct {
+	ha   []int
+	nrec int
+	rchg []bool // with a false sentinel before the first line and after the last one
+}
+
+func newDiffFile(ha []int) *diffFile {
+	return &diffFile{ha: ha, nrec: len(ha), rchg: make([]bool, len(ha)+2)}
+}
+
+func (file *diffFile) changed(n int) bool {
+	return file.rchg[n+1]
+}
+
+func (file *diffFile) setChanged(n int, changed bool) {
+	file.rchg[n+1] = changed
+}
+
+// bogoSqrt is git's cheap approximation of a square root, used to scale heuristics
+func bogoSqrt(n int) int {
+	i := 1
+	for ; n > 0; n >>= 2 {
+		i <<= 1
+	}
+	return i
+}
+
+// myersDiff marks changed lines between lines [off1, lim1) of file1 and [off2, lim2) of file2. As git does, the
+// common prefix and suffix are skipped, and lines without any match on the other side are marked changed before
+// running the algorithm on the remaining ones.
+func myersDiff(file1, file2 *diffFile, off1, lim1, off2, lim2 int) {
+	ha1, ha2 := file1.ha[off1:lim1], file2.ha[off2:lim2]
+
+	count1, count2 := make(map[int]int), make(map[int]int)
+	for _, class := range ha1 {
+		count1[class]++
+	}
+	for _, class := range ha2 {
+		count2[class]++
+	}
+
+	dstart := 0
+	for dstart < min(len(ha1), len(ha2)) && ha1[dstart] == ha2[dstart] {
+		dstart++
+	}
+	trimmed := 0
+	for trimmed < min(len(ha1), len(ha2))-dstart && ha1[len(ha1)-1-trimmed] == ha2[len(ha2)-1-trimmed] {
+		trimmed++
+	}
+
+	// lines are kept (1), discarded when they have no match (0), or discarded when they have many matches (2)
+	// and are surrounded by discarded lines
+	classify := func(ha []int, others map[int]int) []byte {
+		dis := make([]byte, len(ha))
+		limit := min(bogoSqrt(len(ha)), MYERS_MAX_EQ_LIMIT)
+		for n := dstart; n < len(ha)-trimmed; n++ {
+			switch matches := others[ha[n]]; {
+			case matches == 0:
+				dis[n] = 0
+			case matches >= limit:
+				dis[n] = 2
+			default:
+				dis[n] = 1
+			}
+		}
+		return dis
+	}
+
+	effective := func(file *diffFile, offset int, ha []int, dis []byte) ([]int, []int) {
+		kept, index := make([]int, 0), make([]int, 0)
+		for n := dstart; n < len(ha)-trimmed; n++ {
+			if dis[n] == 1 || (dis[n] == 2 && !cleanMultiMatch(dis, n, dstart, len(ha)-trimmed-1)) {
+				kept = append(kept, ha[n])
+				index = append(index, offset+n)
+			} else {
+				file.setChanged(offset+n, true)
+			}
+		}
+		return kept, index
+	}
+
+	dis1 := classify(ha1, count2)
+	dis2 := classify(ha2, count1)
+	kept1, index1 := effective(file1, off1, ha1, dis1)
+	kept2, index2 := effective(file2, off2, ha2, dis2)
+
+	diags := len(kept1) + len(kept2) + 3
+	env := &myersEnv{
+		file1: file1, file2: file2,
+		ha1: kept1, ha2: kept2,
+		index1: index1, index2: index2,
+		kvdf:    make([]int, diags),
+		kvdb:    make([]int, diags),
+		offset:  len(kept2) + 1,
+		maxCost: max(bogoSqrt(diags), MYERS_MAX_COST_MIN),
+	}
+	env.compare(0, len(kept1), 0, len(kept2), false)
+}
+
+// cleanMultiMatch returns true if the line n, which has many matches, is in a run of mostly unmatched lines
+func cleanMultiMatch(dis []byte, n, start, end int) bool {
+	start = max(start, n-MYERS_SIMSCAN_WINDOW)
+	end = min(end, n+MYERS_SIMSCAN_WINDOW)
+
+	before, multiBefore := 0, 1
+	for r := 1; n-r >= start; r++ {
+		if dis[n-r] == 0 {
+			before++
+		} else if dis[n-r] == 2 {
+			multiBefore++
+		} else {
+			break
+		}
+	}
+	if before == 0 {
+		return false
+	}
+
+	after, multiAfter := 0, 1
+	for r := 1; n+r <= end; r++ {
+		if dis[n+r] == 0 {
+			after++
+		} else if dis[n+r] == 2 {
+			multiAfter++
+		} else {
+			break
+		}
+	}
+	if after == 0 {
+		return false
+	}
+
+	unmatched := before + after
+	multi := multiBefore + multiAfter
+
+	return multi*MYERS_KPDIS_RUN < multi+unmatched
+}
+
+type myersEnv struct {
+	file1, file2   *diffFile
+	ha1, ha2       []int // classes of the lines taking part in the diff
+	index1, index2 []int // position of those lines in their file
+	kvdf, kvdb     []int // furthest reaching paths, forward & backward, by diagonal
+	offset         int   // index of diagonal 0 in kvdf & kvdb
+	maxCost        int
+}
+
+func (env *myersEnv) forward(d int) int    { return env.kvdf[d+env.offset] }
+func (env *myersEnv) backward(d int) int   { return env.kvdb[d+env.offset] }
+func (env *myersEnv) setForward(d, v int)  { env.kvdf[d+env.offset] = v }
+func (env *myersEnv) setBackward(d, v int) { env.kvdb[d+env.offset] = v }
+
+// compare marks changed lines between [off1, lim1) and [off2, lim2), splitting the problem in two around the
+// middle snake of the edit path
+func (env *myersEnv) compare(off1, lim1, off2, lim2 int, needMin bool) {
+	for off1 < lim1 && off2 < lim2 && env.ha1[off1] == env.ha2[off2] {
+		off1++
+		off2++
+	}
+	for off1 < lim1 && off2 < lim2 && env.ha1[lim1-1] == env.ha2[lim2-1] {
+		lim1--
+		lim2--
+	}
+
+	switch {
+	case off1 == lim1:
+		for ; off2 < lim2; off2++ {
+			env.file2.setChanged(env.index2[off2], true)
+		}
+	case off2 == lim2:
+		for ; off1 < lim1; off1++ {
+			env.file1.setChanged(env.index1[off1], true)
+		}
+	default:
+		i1, i2, minLow, minHigh := env.split(off1, lim1, off2, lim2, needMin)
+		env.compare(off1, i1, off2, i2, minLow)
+		env.compare(i1, lim1, i2, lim2, minHigh)
+	}
+}
+
+// split finds the point where the forward and backward searches meet. Unless needMin is set, the search is cut
+// short on long snakes or high edit costs.
+func (env *myersEnv) split(off1, lim1, off2, lim2 int, needMin bool) (int, int, bool, bool) {
+	dmin, dmax := off1-lim2, lim1-off2
+	fmid, bmid := off1-off2, lim1-lim2
+	odd := (fmid-bmid)&1 != 0
+	fmin, fmax := fmid, fmid
+	bmin, bmax := bmid, bmid
+
+	env.setForward(fmid, off1)
+	env.setBackward(bmid, lim1)
+
+	for cost := 1; ; cost++ {
+		gotSnake := false
+
+		if fmin > dmin {
+			fmin--
+			env.setForward(fmin-1, -1)
+		} else {
+			fmin++
+		}
+		if fmax < dmax {
+			fmax++
+			env.setForward(fmax+1, -1)
+		} else {
+			fmax--
+		}
+
+		for d := fmax; d >= fmin; d -= 2 {
+			var i1 int
+			if env.forward(d-1) >= env.forward(d+1) {
+				i1 = env.forward(d-1) + 1
+			} else {
+				i1 = env.forward(d + 1)
+			}
+			prev := i1
+			i2 := i1 - d
+			for i1 < lim1 && i2 < lim2 && env.ha1[i1] == env.ha2[i2] {
+				i1++
+				i2++
+			}
+			if i1-prev > MYERS_SNAKE_COUNT {
+				gotSnake = true
+			}
+			env.setForward(d, i1)
+			if odd && bmin <= d && d <= bmax && env.backward(d) <= i1 {
+				return i1, i2, true, true
+			}
+		}
+
+		if bmin > dmin {
+			bmin--
+			env.setBackward(bmin-1, math.MaxInt)
+		} else {
+			bmin++
+		}
+		if bmax < dmax {
+			bmax++
+			env.setBackward(bmax+1, math.MaxInt)
+		} else {
+			bmax--
+		}
+
+		for d := bmax; d >= bmin; d -= 2 {
+			var i1 int
+			if env.backward(d-1) < env.backward(d+1) {
+				i1 = env.backward(d - 1)
+			} else {
+				i1 = env.backward(d+1) - 1
+			}
+			prev := i1
+			i2 := i1 - d
+			for i1 > off1 && i2 > off2 && env.ha1[i1-1] == env.ha2[i2-1] {
+				i1--
+				i2--
+			}
+			if prev-i1 > MYERS_SNAKE_COUNT {
+				gotSnake = true
+			}
+			env.setBackward(d, i1)
+			if !odd && fmin <= d && d <= fmax && i1 <= env.forward(d) {
+				return i1, i2, true, true
+			}
+		}
+
+		if needMin {
+			continue
+		}
+
+		// with a high enough cost, a diagonal which went far on a good snake is used to split the search
+		if gotSnake && cost > MYERS_HEURISTIC_COST {
+			best, split1, split2 := 0, 0, 0
+			for d := fmax; d >= fmin; d -= 2 {
+				dd := max(d-fmid, fmid-d)
+				i1 := env.forward(d)
+				i2 := i1 - d
+				v := (i1 - off1) + (i2 - off2) - dd
+
+				if v > MYERS_HEURISTIC_K*cost && v > best &&
+					off1+MYERS_SNAKE_COUNT <= i1 && i1 < lim1 && off2+MYERS_SNAKE_COUNT <= i2 && i2 < lim2 {
+					for k := 1; env.ha1[i1-k] == env.ha2[i2-k]; k++ {
+						if k == MYERS_SNAKE_COUNT {
+							best, split1, split2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return split1, split2, true, false
+			}
+
+			for d := bmax; d >= bmin; d -= 2 {
+				dd := max(d-bmid, bmid-d)
+				i1 := env.backward(d)
+				i2 := i1 - d
+				v := (lim1 - i1) + (lim2 - i2) - dd
+
+				if v > MYERS_HEURISTIC_K*cost && v > best &&
+					off1 < i1 && i1 <= lim1-MYERS_SNAKE_COUNT && off2 < i2 && i2 <= lim2-MYERS_SNAKE_COUNT {
+					for k := 0; env.ha1[i1+k] == env.ha2[i2+k]; k++ {
+						if k == MYERS_SNAKE_COUNT-1 {
+							best, split1, split2 = v, i1, i2
+							break
+						}
+					}
+				}
+			}
+			if best > 0 {
+				return split1, split2, false, true
+			}
+		}
+
+		// past the maximum cost, the furthest reaching path is used
+		if cost >= env.maxCost {
+			fbest, fbest1 := -1, -1
+			for d := fmax; d >= fmin; d -= 2 {
+				i1 := min(env.forward(d), lim1)
+				i2 := i1 - d
+				if lim2 < i2 {
+					i1 = lim2 + d
+					i2 = lim2
+				}
+				if fbest < i1+i2 {
+					fbest, fbest1 = i1+i2, i1
+				}
+			}
+
+			bbest, bbest1 := math.MaxInt, math.MaxInt
+			for d := bmax; d >= bmin; d -= 2 {
+				i1 := max(off1, env.backward(d))
+				i2 := i1 - d
+				if i2 < off2 {
+					i1 = off2 + d
+					i2 = off2
+				}
+				if i1+i2 < bbest {
+					bbest, bbest1 = i1+i2, i1
+				}
+			}
+
+			if (lim1+lim2)-bbest < fbest-(off1+off2) {
+				return fbest1, fbest - fbest1, true, false
+			}
+			return bbest1, bbest - bbest1, false, true
+		}
+	}
+}
+
+// histogramRecord holds the occurrences of a line in the old side of a histogram diff region
+type histogramRecord struct {
+	ptr int // first occurrence
+	cnt int // number of occurrences
+}
+
+// histogramDiff marks changed lines between lines [line1, line1+count1) of file1 and [line2, line2+count2) of
+// file2, lines starting at 1. The longest common run of lines occurring the least is matched, and lines before and
+// after it are diffed recursively.
+func histogramDiff(file1, file2 *diffFile, line1, count1, line2, count2 int) {
+	for count1 > 0 || count2 > 0 {
+		if count1 == 0 {
+			for ; count2 > 0; count2-- {
+				file2.setChanged(line2-1, true)
+				line2++
+			}
+			return
+		}
+		if count2 == 0 {
+			for ; count1 > 0; count1-- {
+				file1.setChanged(line1-1, true)
+				line1++
+			}
+			return
+		}
+
+		begin1, end1, begin2, end2, fallback := histogramLCS(file1, file2, line1, count1, line2, count2)
+
+		if fallback {
+			myersDiff(file1, file2, line1-1, line1-1+count1, line2-1, line2-1+count2)
+			return
+		}
+
+		if begin1 == 0 && begin2 == 0 {
+			for ; count1 > 0; count1-- {
+				file1.setChanged(line1-1, true)
+				line1++
+			}
+			for ; count2 > 0; count2-- {
+				file2.setChanged(line2-1, true)
+				line2++
+			}
+			return
+		}
+
+		histogramDiff(file1, file2, line1, begin1-line1, line2, begin2-line2)
+
+		end := line1 + count1 - 1
+		count1 = end - end1
+		line1 = end1 + 1
+		end = line2 + count2 - 1
+		count2 = end - end2
+		line2 = end2 + 1
+	}
+}
+
+// histogramLCS returns the longest common run of lines occurring the least, as first & last lines on both sides,
+// or zeros if there is none. fallback is true if all common lines occur too often for the histogram to be useful.
+func histogramLCS(file1, file2 *diffFile, line1, count1, line2, count2 int) (int, int, int, int, bool) {
+	records := make(map[int]*histogramRecord)
+	lineRecords := make([]*histogramRecord, count1)
+	nextPtrs := make([]int, count1)
+	lineEnd1, lineEnd2 := line1+count1-1, line2+count2-1
+
+	for ptr := lineEnd1; ptr >= line1; ptr-- {
+		class := file1.ha[ptr-1]
+		if record, ok := records[class]; ok {
+			nextPtrs[ptr-line1] = record.ptr
+			record.ptr = ptr
+			record.cnt++
+			lineRecords[ptr-line1] = record
+		} else {
+			record := &histogramRecord{ptr: ptr, cnt: 1}
+			records[class] = record
+			lineRecords[ptr-line1] = record
+		}
+	}
+
+	var begin1, end1, begin2, end2 int
+	maxCount := HISTOGRAM_MAX_CHAIN_LENGTH + 1
+	hasCommon := false
+
+	for bPtr := line2; bPtr <= lineEnd2; {
+		bNext := bPtr + 1
+		record, ok := records[file2.ha[bPtr-1]]
+
+		if ok && record.cnt > maxCount {
+			hasCommon = true
+		} else if ok {
+			hasCommon = true
+			for as := record.ptr; ; {
+				np := nextPtrs[as-line1]
+				bs, ae, be := bPtr, as, bPtr
+				rc := record.cnt
+
+				for line1 < as && line2 < bs && file1.ha[as-2] == file2.ha[bs-2] {
+					as--
+					bs--
+					if rc > 1 {
+						rc = min(rc, lineRecords[as-line1].cnt)
+					}
+				}
+				for ae < lineEnd1 && be < lineEnd2 && file1.ha[ae] == file2.ha[be] {
+					ae++
+					be++
+					if rc > 1 {
+						rc = min(rc, lineRecords[ae-line1].cnt)
+					}
+				}
+
+				if bNext <= be {
+					bNext = be + 1
+				}
+				if end1-begin1 < ae-as || rc < maxCount {
+					begin1, begin2, end1, end2 = as, bs, ae, be
+					maxCount = rc
+				}
+
+				if np == 0 {
+					break
+				}
+				for np != 0 && np <= ae {
+					np = nextPtrs[np-line1]
+				}
+				if np == 0 {
+					break
+				}
+				as = np
+			}
+		}
+
+		bPtr = bNext
+	}
+
+	if hasCommon && maxCount > HISTOGRAM_MAX_CHAIN_LENGTH {
+		return 0, 0, 0, 0, true
+	}
+
+	return begin1, end1, begin2, end2, false
+}
+
+// compact slides groups of changed lines, which can be moved when lines before or after them are the same, to
+// align them with changes of the other file, or else to where they look the most natural, as git does
+func (file *diffFile) compact(other *diffFile, lines []string) {
+	g := diffGroup{}
+	for g.end < file.nrec && file.changed(g.end) {
+		g.end++
+	}
+	og := diffGroup{}
+	for og.end < other.nrec && other.changed(og.end) {
+		og.end++
+	}
+
+	for {
+		if g.end != g.start {
+			var groupSize, earliestEnd, endMatchingOther int
+
+			// slide the group up then down as far as possible, merging it with adjacent groups, until its size
+			// is stable
+			for {
+				groupSize = g.end - g.start
+				endMatchingOther = -1
+
+				for file.slideUp(&g) {
+					other.previous(&og)
+				}
+				earliestEnd = g.end
+				if og.end > og.start {
+					endMatchingOther = g.end
+				}
+
+				for file.slideDown(&g) {
+					other.next(&og)
+					if og.end > og.start {
+						endMatchingOther = g.end
+					}
+				}
+
+				if groupSize == g.end-g.start {
+					break
+				}
+			}
+
+			switch {
+			case g.end == earliestEnd:
+				// the group can't be moved
+
+			case endMatchingOther != -1:
+				for og.end == og.start {
+					file.slideUp(&g)
+					other.previous(&og)
+				}
+
+			default:
+				shift := max(earliestEnd, g.end-groupSize-1, g.end-INDENT_MAX_SLIDING)
+				bestShift := -1
+				var bestScore splitScore
+
+				for ; shift <= g.end; shift++ {
+					score := splitScore{}
+					score.add(measureSplit(lines, shift))
+					score.add(measureSplit(lines, shift-groupSize))
+
+					if bestShift == -1 || score.compare(bestScore) <= 0 {
+						bestScore = score
+						bestShift = shift
+					}
+				}
+
+				for g.end > bestShift {
+					file.slideUp(&g)
+					other.previous(&og)
+				}
+			}
+		}
+
+		if !file.next(&g) {
+			break
+		}
+		other.next(&og)
+	}
+}
+
+// diffGroup is a run of changed lines [start, end), possibly empty
+type diffGroup struct {
+	start int
+	end   int
+}
+
+func (file *diffFile) next(g *diffGroup) bool {
+	if g.end == file.nrec {
+		return false
+	}
+	g.start = g.end + 1
+	for g.end = g.start; file.changed(g.end); g.end++ {
+	}
+	return true
+}
+
+func (file *diffFile) previous(g *diffGroup) bool {
+	if g.start == 0 {
+		return false
+	}
+	g.end = g.start - 1
+	for g.start = g.end; file.changed(g.start - 1); g.start-- {
+	}
+	return true
+}
+
+func (file *diffFile) slideDown(g *diffGroup) bool {
+	if g.end >= file.nrec || file.ha[g.start] != file.ha[g.end] {
+		return false
+	}
+
+	file.setChanged(g.start, false)
+	file.setChanged(g.end, true)
+	g.start++
+	g.end++
+	for file.changed(g.end) {
+		g.end++
+	}
+	return true
+}
+
+func (file *diffFile) slideUp(g *diffGroup) bool {
+	if g.start <= 0 || file.ha[g.start-1] != file.ha[g.end-1] {
+		return false
+	}
+
+	g.start--
+	g.end--
+	file.setChanged(g.start, true)
+	file.setChanged(g.end, false)
+	for file.changed(g.start - 1) {
+		g.start--
+	}
+	return true
+}
+
+// lineIndent returns the width of the leading whitespace of a line, or -1 if it is blank
+func lineIndent(line string) int {
+	indent := 0
+	for _, c := range []byte(line) {
+		switch c {
+		case ' ':
+			indent++
+		case '\t':
+			indent += 8 - indent%8
+		case '\n', '\r', '\f', '\v':
+		default:
+			return indent
+		}
+		if indent >= INDENT_MAX {
+			return INDENT_MAX
+		}
+	}
+	return -1
+}
+
+type splitMeasurement struct {
+	endOfFile  bool
+	indent     int
+	preBlank   int
+	preIndent  int
+	postBlank  int
+	postIndent int
+}
+
+// measureSplit measures the surroundings of a split between lines split-1 and split
+func measureSplit(lines []string, split int) splitMeasurement {
+	m := splitMeasurement{indent: -1, preIndent: -1, postIndent: -1}
+
+	if split >= len(lines) {
+		m.endOfFile = true
+	} else {
+		m.indent = lineIndent(lines[split])
+	}
+
+	for n := split - 1; n >= 0; n-- {
+		if m.preIndent = lineIndent(lines[n]); m.preIndent != -1 {
+			break
+		}
+		m.preBlank++
+		if m.preBlank == INDENT_MAX_BLANKS {
+			m.preIndent = 0
+			break
+		}
+	}
+
+	for n := split + 1; n < len(lines); n++ {
+		if m.postIndent = lineIndent(lines[n]); m.postIndent != -1 {
+			break
+		}
+		m.postBlank++
+		if m.postBlank == INDENT_MAX_BLANKS {
+			m.postIndent = 0
+			break
+		}
+	}
+
+	return m
+}
+
+type splitScore struct {
+	effectiveIndent int
+	penalty         int
+}
+
+func (s *splitScore) add(m splitMeasurement) {
+	if m.preIndent == -1 && m.preBlank == 0 {
+		s.penalty += INDENT_START_OF_FILE_PENALTY
+	}
+	if m.endOfFile {
+		s.penalty += INDENT_END_OF_FILE_PENALTY
+	}
+
+	postBlank := 0
+	if m.indent == -1 {
+		postBlank = 1 + m.postBlank
+	}
+	totalBlank := m.preBlank + postBlank
+
+	s.penalty += INDENT_TOTAL_BLANK_WEIGHT * totalBlank
+	s.penalty += INDENT_POST_BLANK_WEIGHT * postBlank
+
+	indent := m.indent
+	if indent == -1 {
+		indent = m.postIndent
+	}
+	anyBlanks := totalBlank != 0
+
+	s.effectiveIndent += indent
+
+	pick := func(withBlank, without int) int {
+		if anyBlanks {
+			return withBlank
+		}
+		return without
+	}
+
+	switch {
+	case indent == -1, m.preIndent == -1, indent == m.preIndent:
+	case indent > m.preIndent:
+		s.penalty += pick(INDENT_RELATIVE_INDENT_WITH_BLANK, INDENT_RELATIVE_INDENT_PENALTY)
+	case m.postIndent != -1 && m.postIndent > indent:
+		s.penalty += pick(INDENT_RELATIVE_OUTDENT_WITH_BLANK, INDENT_RELATIVE_OUTDENT_PENALTY)
+	default:
+		s.penalty += pick(INDENT_RELATIVE_DEDENT_WITH_BLANK, INDENT_RELATIVE_DEDENT_PENALTY)
+	}
+}
+
+func (s splitScore) compare(other splitScore) int {
+	cmp := 0
+	if s.effectiveIndent > other.effectiveIndent {
+		cmp = 1
+	} else if s.effectiveIndent < other.effectiveIndent {
+		cmp = -1
+	}
+	return INDENT_WEIGHT*cmp + s.penalty - other.penalty
+}
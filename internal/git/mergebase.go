@@ -0,0 +1,253 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	PAINT_PARENT1 = 1 << iota // reachable from the first commit
+	PAINT_PARENT2             // reachable from one of the other commits
+	PAINT_STALE               // reachable from a common ancestor already found
+	PAINT_RESULT              // common ancestor
+)
+
+// ErrNoMergeBase is returned when commits do not share any history
+var ErrNoMergeBase = errors.New("no merge base found")
+
+// paintDownToCommon walks the history from one and others, painting commits by the side they are reachable from,
+// and returns the commits reachable from both sides which are not ancestors of an already found one, along with
+// the paint of all walked commits. The result may still contain commits which are ancestors of others, because of
+// clock skew.
+func (repo Repository) paintDownToCommon(one ObjectID, others []ObjectID) ([]*Commit, map[ObjectID]int, error) {
+	queue := &commitQueue{generation: true}
+	flags := make(map[ObjectID]int)
+	commits := make(map[ObjectID]*Commit)
+	result := make([]*Commit, 0)
+
+	paint := func(hash ObjectID, flag int) error {
+		if flags[hash]&flag == flag {
+			return nil
+		}
+		flags[hash] |= flag
+
+		commit, ok := commits[hash]
+		if !ok {
+			var err error
+			if commit, err = repo.openGraphCommit(hash); err != nil {
+				return err
+			}
+			commits[hash] = commit
+		}
+		queue.PushCommit(commit)
+
+		return nil
+	}
+
+	if err := paint(one, PAINT_PARENT1); err != nil {
+		return nil, nil, err
+	}
+	for _, other := range others {
+		if err := paint(other, PAINT_PARENT2); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// the walk stops once only stale commits remain in the queue. As with rev walks, a few more commits are walked
+	// to cope with clock skew, so that ancestors walked too early are painted by both sides.
+	slop := REVWALK_SLOP
+	for queue.Len() > 0 {
+		stale := true
+		for _, entry := range queue.entries {
+			if flags[entry.commit.Hash]&PAINT_STALE == 0 {
+				stale = false
+				break
+			}
+		}
+		if !stale {
+			slop = REVWALK_SLOP
+		} else if slop--; slop == 0 {
+			break
+		}
+
+		commit := queue.PopCommit()
+		commitFlags := flags[commit.Hash] & (PAINT_PARENT1 | PAINT_PARENT2 | PAINT_STALE)
+
+		if commitFlags == PAINT_PARENT1|PAINT_PARENT2 {
+			if flags[commit.Hash]&PAINT_RESULT == 0 {
+				flags[commit.Hash] |= PAINT_RESULT
+				result = append(result, commit)
+			}
+			// parents of a common ancestor can't be the best common ancestors
+			commitFlags |= PAINT_STALE
+		}
+
+		for _, parent := range commit.Parents {
+			if err := paint(parent, commitFlags); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	return result, flags, nil
+}
+
+// removeRedundant removes from commits the ones which are ancestors of others
+func (repo Repository) removeRedundant(commits []*Commit) ([]*Commit, error) {
+	if len(commits) < 2 {
+		return commits, nil
+	}
+
+	redundant := make(map[ObjectID]bool)
+
+	for n, commit := range commits {
+		if redundant[commit.Hash] {
+			continue
+		}
+
+		others := make([]ObjectID, 0, len(commits)-1)
+		for m, other := range commits {
+			if m != n && !redundant[other.Hash] {
+				others = append(others, other.Hash)
+			}
+		}
+
+		_, flags, err := repo.paintDownToCommon(commit.Hash, others)
+		if err != nil {
+			return nil, err
+		}
+
+		// commit is reachable from others, or some of others are reachable from commit
+		if flags[commit.Hash]&PAINT_PARENT2 != 0 {
+			redundant[commit.Hash] = true
+		}
+		for _, other := range others {
+			if flags[other]&PAINT_PARENT1 != 0 {
+				redundant[other] = true
+			}
+		}
+	}
+
+	result := make([]*Commit, 0, len(commits))
+	for _, commit := range commits {
+		if !redundant[commit.Hash] {
+			result = append(result, commit)
+		}
+	}
+
+	return result, nil
+}
+
+// MergeBases returns all the best common ancestors of one and a hypothetical merge of others, most recent first.
+// With a single other commit, those are the merge bases of both commits.
+func (repo Repository) MergeBases(one ObjectID, others ...ObjectID) ([]ObjectID, error) {
+	for _, other := range others {
+		if other == one {
+			return []ObjectID{one}, nil
+		}
+	}
+
+	common, _, err := repo.paintDownToCommon(one, others)
+	if err != nil {
+		return nil, err
+	}
+
+	if common, err = repo.removeRedundant(common); err != nil {
+		return nil, err
+	}
+
+	hashes := make([]ObjectID, 0, len(common))
+	for _, commit := range common {
+		hashes = append(hashes, commit.Hash)
+	}
+
+	return hashes, nil
+}
+
+// MergeBase returns the best common ancestor of two commits. If there is more than one, the most recent one is
+// returned.
+func (repo Repository) MergeBase(a, b ObjectID) (ObjectID, error) {
+	bases, err := repo.MergeBases(a, b)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	if len(bases) == 0 {
+		return ObjectID{}, fmt.Errorf("%w between %s and %s", ErrNoMergeBase, a, b)
+	}
+
+	return bases[0], nil
+}
+
+// OctopusMergeBases returns the best common ancestors of all the given commits, as for an octopus merge
+func (repo Repository) OctopusMergeBases(commits ...ObjectID) ([]ObjectID, error) {
+	if len(commits) == 0 {
+		return []ObjectID{}, nil
+	}
+
+	bases := []ObjectID{commits[0]}
+
+	for _, commit := range commits[1:] {
+		found := make([]ObjectID, 0)
+		seen := make(map[ObjectID]bool)
+
+		for _, base := range bases {
+			newBases, err := repo.MergeBases(base, commit)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, newBase := range newBases {
+				if !seen[newBase] {
+					seen[newBase] = true
+					found = append(found, newBase)
+				}
+			}
+		}
+
+		if len(found) == 0 {
+			return []ObjectID{}, nil
+		}
+		bases = found
+	}
+
+	return bases, nil
+}
+
+// IsAncestor returns true if ancestor is reachable from commit
+func (repo Repository) IsAncestor(ancestor, commit ObjectID) (bool, error) {
+	bases, err := repo.MergeBases(ancestor, commit)
+	if err != nil {
+		return false, err
+	}
+
+	for _, base := range bases {
+		if base == ancestor {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// AheadBehind returns the number of commits reachable from a but not from b (ahead), and reachable from b but not
+// from a (behind). Both are counted in a single walk painting commits by the side they are reachable from, ordered
+// by generation number when the commit-graph has them.
+func (repo Repository) AheadBehind(a, b ObjectID) (int, int, error) {
+	_, flags, err := repo.paintDownToCommon(a, []ObjectID{b})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	ahead, behind := 0, 0
+	for _, flag := range flags {
+		switch flag & (PAINT_PARENT1 | PAINT_PARENT2) {
+		case PAINT_PARENT1:
+			ahead++
+		case PAINT_PARENT2:
+			behind++
+		}
+	}
+
+	return ahead, behind, nil
+}
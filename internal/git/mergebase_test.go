@@ -0,0 +1,97 @@
+package git
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// reachable returns the names of the commits reachable from a commit, as listed by git
+func (repo *testRepo) reachable(name string) map[string]bool {
+	commits := make(map[string]bool)
+
+	for _, hash := range strings.Split(repo.git(nil, "rev-list", name), "\n") {
+		id, _ := ParseObjectID(hash)
+		commits[repo.names([]ObjectID{id})[0]] = true
+	}
+
+	return commits
+}
+
+// TestMergeBases checks merge bases and ahead/behind counts of every pair of commits of the walk tests' histories.
+// Without a commit-graph, commits are walked by date, and histories skewed more than the walk's slop are skipped.
+func TestMergeBases(t *testing.T) {
+	for _, history := range walkHistories {
+		for _, withGraph := range []bool{false, true} {
+			if history.exact != nil && !withGraph {
+				continue
+			}
+
+			repo := newTestRepo(t)
+			history.build(repo)
+			repository := repo.open(withGraph)
+
+			names := make([]string, 0, len(repo.commits))
+			for name := range repo.commits {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+
+			for _, a := range names {
+				for _, b := range names {
+					hashA, _ := ParseObjectID(repo.commits[a])
+					hashB, _ := ParseObjectID(repo.commits[b])
+
+					reachableA, reachableB := repo.reachable(a), repo.reachable(b)
+					expectedAhead, expectedBehind := 0, 0
+					for name := range reachableA {
+						if !reachableB[name] {
+							expectedAhead++
+						}
+					}
+					for name := range reachableB {
+						if !reachableA[name] {
+							expectedBehind++
+						}
+					}
+
+					ahead, behind, err := repository.AheadBehind(hashA, hashB)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if ahead != expectedAhead || behind != expectedBehind {
+						t.Errorf("%s (graph: %v): ahead-behind %s %s = %d %d, expected %d %d", history.name, withGraph,
+							a, b, ahead, behind, expectedAhead, expectedBehind)
+					}
+
+					bases, err := repository.MergeBases(hashA, hashB)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got := repo.names(bases)
+					slices.Sort(got)
+
+					expected := strings.Fields(repo.git(nil, "merge-base", "--all", a, b))
+					for n, hash := range expected {
+						id, _ := ParseObjectID(hash)
+						expected[n] = repo.names([]ObjectID{id})[0]
+					}
+					slices.Sort(expected)
+
+					if !slices.Equal(got, expected) {
+						t.Errorf("%s (graph: %v): merge-base --all %s %s = %v, expected %v", history.name, withGraph,
+							a, b, got, expected)
+					}
+
+					isAncestor, err := repository.IsAncestor(hashA, hashB)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if isAncestor != reachableB[a] {
+						t.Errorf("%s (graph: %v): is-ancestor %s %s = %v", history.name, withGraph, a, b, isAncestor)
+					}
+				}
+			}
+		}
+	}
+}
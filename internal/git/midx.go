@@ -0,0 +1,196 @@
+package git
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+)
+
+const (
+	// name of the multi-pack-index in errors, as it covers several packs
+	MIDX_FILE_NAME = "multi-pack-index"
+
+	MIDX_CHUNK_PACK_NAMES    = "PNAM"
+	MIDX_CHUNK_OID_FANOUT    = "OIDF"
+	MIDX_CHUNK_OID_LOOKUP    = "OIDL"
+	MIDX_CHUNK_OBJECT_OFFSET = "OOFF"
+	MIDX_CHUNK_LARGE_OFFSET  = "LOFF"
+)
+
+// MultiPackIndex is a parsed "<repo>/.git/objects/pack/multi-pack-index" file, indexing objects of many packs at once.
+// As for pack indexes, its tables are kept as they are in the file.
+type MultiPackIndex struct {
+	PackFiles []string // .pack file names, by pack-int-id
+	Fanout    [256]uint32
+
+	format       ObjectFormat
+	hashes       []byte
+	offsets      []byte // pack-int-id & offset of each object
+	largeOffsets []byte
+}
+
+func (repo Repository) GetMultiPackIndexPath() string {
+	return path.Join(repo.GetPackDir(), MIDX_FILE_NAME)
+}
+
+// readChunks parses a chunk lookup table of chunksNum entries found at data[start:] and returns each chunk's data
+func readChunks(data []byte, start int, chunksNum int) (map[string][]byte, error) {
+	chunks := make(map[string][]byte)
+
+	// The table has an extra terminating entry holding the end offset of the last chunk
+	if len(data) < start+12*(chunksNum+1) {
+		return chunks, fmt.Errorf("truncated chunk lookup table")
+	}
+
+	for n := range chunksNum {
+		entry := data[start+12*n:]
+		chunkId := string(entry[0:4])
+		chunkStart := binary.BigEndian.Uint64(entry[4:12])
+		chunkEnd := binary.BigEndian.Uint64(entry[16:24])
+
+		if chunkStart > chunkEnd || chunkEnd > uint64(len(data)) {
+			return chunks, fmt.Errorf("invalid chunk offsets for %s", chunkId)
+		}
+
+		chunks[chunkId] = data[chunkStart:chunkEnd]
+	}
+
+	return chunks, nil
+}
+
+// OpenMultiPackIndex opens and parses the multi-pack-index file. It returns a nil index if there is none.
+func (repo Repository) OpenMultiPackIndex() (*MultiPackIndex, error) {
+	data, err := os.ReadFile(repo.GetMultiPackIndexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(data) < 12 || !reflect.DeepEqual(data[0:4], []byte("MIDX")) {
+		return nil, &ErrCorruptPack{Pack: MIDX_FILE_NAME, Err: fmt.Errorf("invalid header")}
+	}
+	if data[4] != 1 {
+		return nil, fmt.Errorf("%w for multi-pack-index: %d", ErrUnsupportedVersion, data[4])
+	}
+	if uint32(data[5]) != repo.ObjectFormat.HashId() {
+		return nil, fmt.Errorf("unsupported hash function for multi-pack-index: %d", data[5])
+	}
+	if data[7] != 0 {
+		return nil, fmt.Errorf("incremental multi-pack-index are not supported")
+	}
+
+	packsNum := binary.BigEndian.Uint32(data[8:12])
+
+	chunks, err := readChunks(data, 12, int(data[6]))
+	if err != nil {
+		return nil, &ErrCorruptPack{Pack: MIDX_FILE_NAME, Err: err}
+	}
+
+	for _, chunkId := range []string{MIDX_CHUNK_PACK_NAMES, MIDX_CHUNK_OID_FANOUT, MIDX_CHUNK_OID_LOOKUP, MIDX_CHUNK_OBJECT_OFFSET} {
+		if _, ok := chunks[chunkId]; !ok {
+			return nil, &ErrCorruptPack{Pack: MIDX_FILE_NAME, Err: fmt.Errorf("missing %s chunk", chunkId)}
+		}
+	}
+
+	midx := &MultiPackIndex{}
+
+	// Pack names are null terminated .idx file names
+	for _, name := range strings.Split(string(chunks[MIDX_CHUNK_PACK_NAMES]), "\x00") {
+		if name == "" {
+			continue
+		}
+		midx.PackFiles = append(midx.PackFiles, strings.TrimSuffix(name, ".idx")+".pack")
+	}
+	if len(midx.PackFiles) != int(packsNum) {
+		return nil, &ErrCorruptPack{Pack: MIDX_FILE_NAME, Err: fmt.Errorf("invalid pack names count: %d != %d", len(midx.PackFiles), packsNum)}
+	}
+
+	fanout := chunks[MIDX_CHUNK_OID_FANOUT]
+	if len(fanout) != 256*4 {
+		return nil, &ErrCorruptPack{Pack: MIDX_FILE_NAME, Err: fmt.Errorf("invalid %s chunk size", MIDX_CHUNK_OID_FANOUT)}
+	}
+	if midx.Fanout, err = readFanout(fanout); err != nil {
+		return nil, &ErrCorruptPack{Pack: MIDX_FILE_NAME, Err: err}
+	}
+
+	entriesNum := int(midx.Fanout[255])
+
+	midx.format = repo.ObjectFormat
+	midx.hashes = chunks[MIDX_CHUNK_OID_LOOKUP]
+	midx.offsets = chunks[MIDX_CHUNK_OBJECT_OFFSET]
+	midx.largeOffsets = chunks[MIDX_CHUNK_LARGE_OFFSET]
+	if len(midx.hashes) != entriesNum*midx.format.Size() || len(midx.offsets) != entriesNum*8 {
+		return nil, &ErrCorruptPack{Pack: MIDX_FILE_NAME, Err: fmt.Errorf("invalid chunk sizes")}
+	}
+
+	return midx, nil
+}
+
+// Contains returns true if the given pack file is covered by the multi-pack-index
+func (midx *MultiPackIndex) Contains(packFile string) bool {
+	for _, name := range midx.PackFiles {
+		if name == packFile {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Len returns the number of objects in the multi-pack-index
+func (midx *MultiPackIndex) Len() int {
+	return int(midx.Fanout[255])
+}
+
+func (midx *MultiPackIndex) hashBytes(n int) []byte {
+	hashSize := midx.format.Size()
+	return midx.hashes[n*hashSize : (n+1)*hashSize]
+}
+
+// HashAt returns the hash of the object at a position of the multi-pack-index
+func (midx *MultiPackIndex) HashAt(n int) ObjectID {
+	hash, _ := NewObjectID(midx.format, midx.hashBytes(n))
+	return hash
+}
+
+func (midx *MultiPackIndex) object(n int) (Object, error) {
+	object := Object{
+		Hash:         midx.HashAt(n),
+		LocationType: LOCATION_PACK,
+	}
+
+	packId := binary.BigEndian.Uint32(midx.offsets[n*8:])
+	if packId >= uint32(len(midx.PackFiles)) {
+		return Object{}, &ErrCorruptPack{Pack: MIDX_FILE_NAME, Err: fmt.Errorf("invalid pack id: %d", packId)}
+	}
+	object.PackFile = midx.PackFiles[packId]
+
+	offset := binary.BigEndian.Uint32(midx.offsets[n*8+4:])
+	if offset&0x80000000 != 0 {
+		largeOffsetIdx := int(offset & 0x7fffffff)
+		if len(midx.largeOffsets) < (largeOffsetIdx+1)*8 {
+			return Object{}, &ErrCorruptPack{Pack: MIDX_FILE_NAME, Err: fmt.Errorf("invalid large offset index: %d", largeOffsetIdx)}
+		}
+		object.Offset = int64(binary.BigEndian.Uint64(midx.largeOffsets[largeOffsetIdx*8:]))
+	} else {
+		object.Offset = int64(offset)
+	}
+
+	return object, nil
+}
+
+// Lookup searches for an object by its hash, using the fanout table to restrict the binary search
+func (midx *MultiPackIndex) Lookup(hash ObjectID) (Object, bool, error) {
+	n, ok := searchFanout(&midx.Fanout, hash, midx.hashBytes)
+	if !ok {
+		return Object{}, false, nil
+	}
+
+	object, err := midx.object(n)
+	return object, err == nil, err
+}
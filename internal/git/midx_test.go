@@ -0,0 +1,133 @@
+package git
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestCorruptMultiPackIndex(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.commit("a", 1000)
+	repo.git(nil, "repack", "-adq")
+	repo.git(nil, "multi-pack-index", "write")
+	repository := repo.open(false)
+
+	midxPath := repository.GetMultiPackIndexPath()
+	data, err := os.ReadFile(midxPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// chunks returns the chunks of a copy of the file, which can be modified in place
+	chunks := func(data []byte) map[string][]byte {
+		chunks, err := readChunks(data, 12, int(data[6]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chunks
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(data []byte) []byte
+	}{
+		{"truncated header", func(data []byte) []byte {
+			return data[:10]
+		}},
+		{"invalid header", func(data []byte) []byte {
+			return append([]byte("XDIM"), data[4:]...)
+		}},
+		{"truncated chunk lookup table", func(data []byte) []byte {
+			return data[:20]
+		}},
+		{"truncated chunks", func(data []byte) []byte {
+			return data[:len(data)/2]
+		}},
+		{"unsorted fanout", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(chunks(data)[MIDX_CHUNK_OID_FANOUT], 0xffffffff)
+			return data
+		}},
+		{"invalid pack names count", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(data[8:], 2)
+			return data
+		}},
+		{"invalid pack id", func(data []byte) []byte {
+			binary.BigEndian.PutUint32(chunks(data)[MIDX_CHUNK_OBJECT_OFFSET], 7)
+			return data
+		}},
+	}
+
+	for _, test := range tests {
+		if err := os.Remove(midxPath); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(midxPath, test.corrupt(append([]byte{}, data...)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		midx, err := repository.OpenMultiPackIndex()
+		if err == nil {
+			_, _, err = midx.Lookup(midx.HashAt(0))
+		}
+
+		var corrupt *ErrCorruptPack
+		if !errors.As(err, &corrupt) {
+			t.Errorf("%s: returned %v, expected a corrupt pack error", test.name, err)
+		}
+	}
+}
+
+func TestMultiPackIndex(t *testing.T) {
+	repo := newTestRepo(t)
+	names := repo.writeHistory()
+	repo.git(nil, "repack", "-dq")
+
+	// a second pack, covered by the multi-pack-index along with the first one
+	files := map[string]string{"README": "second pack\n"}
+	repo.commitTree("w1", repo.tree(files), 2000, names[len(names)-1])
+	repo.git(nil, "repack", "-dq")
+	repo.git(nil, "multi-pack-index", "write")
+
+	// a third pack, which is not covered, and a loose commit
+	files["README"] = "third pack\n"
+	repo.commitTree("w2", repo.tree(files), 2001, "w1")
+	repo.git(nil, "repack", "-dq")
+	repo.commit("loose", 2002, "w2")
+
+	repository := repo.open(false)
+	midx := repository.MultiPackIndex
+	if midx == nil {
+		t.Fatal("the multi-pack-index was not opened")
+	}
+	if len(midx.PackFiles) != 2 || len(repository.Packs) != 3 {
+		t.Fatalf("the multi-pack-index covers %d packs out of %d, expected 2 out of 3", len(midx.PackFiles),
+			len(repository.Packs))
+	}
+
+	covered := 0
+	for packFile, index := range repository.Packs {
+		if midx.Contains(packFile) {
+			covered += index.Len()
+		}
+	}
+	if midx.Len() != covered {
+		t.Errorf("the multi-pack-index has %d objects, expected %d", midx.Len(), covered)
+	}
+
+	for n := range midx.Len() {
+		object, ok, err := midx.Lookup(midx.HashAt(n))
+		if err != nil || !ok {
+			t.Fatalf("%s not found in the multi-pack-index: %v", midx.HashAt(n), err)
+		}
+
+		inPack, ok, err := repository.Packs[object.PackFile].Lookup(object.Hash)
+		if err != nil || !ok || inPack.Offset != object.Offset {
+			t.Errorf("%s is at offset %d of %s in the multi-pack-index, and %d in the pack's index (%v)", object.Hash,
+				object.Offset, object.PackFile, inPack.Offset, err)
+		}
+	}
+
+	repo.checkObjects(repository)
+}
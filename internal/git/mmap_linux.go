@@ -0,0 +1,52 @@
+//go:build linux
+
+package git
+
+import (
+	"os"
+	"syscall"
+)
+
+// mappedFile is a file mapped read-only in memory
+type mappedFile struct {
+	Data []byte
+}
+
+// openMappedFile maps a whole file in memory. The file descriptor is not kept, as the mapping stays valid once it
+// is closed.
+func openMappedFile(filePath string) (*mappedFile, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// empty files can't be mapped
+	if stat.Size() == 0 {
+		return &mappedFile{Data: []byte{}}, nil
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(stat.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, &os.PathError{Op: "mmap", Path: filePath, Err: err}
+	}
+
+	return &mappedFile{Data: data}, nil
+}
+
+// Close unmaps the file. Its data must not be used anymore.
+func (file *mappedFile) Close() error {
+	data := file.Data
+	file.Data = nil
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	return syscall.Munmap(data)
+}
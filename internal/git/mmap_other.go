@@ -0,0 +1,26 @@
+//go:build !linux
+
+package git
+
+import (
+	"os"
+)
+
+// mappedFile is a file read in memory, as files are only mapped on Linux
+type mappedFile struct {
+	Data []byte
+}
+
+func openMappedFile(filePath string) (*mappedFile, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mappedFile{Data: data}, nil
+}
+
+func (file *mappedFile) Close() error {
+	file.Data = nil
+	return nil
+}
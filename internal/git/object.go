@@ -3,7 +3,7 @@ package git
 import (
 	"bytes"
 	"compress/zlib"
-	"crypto/sha1"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -12,6 +12,14 @@ import (
 	"strings"
 )
 
+var (
+	// ErrObjectNotFound is returned when an object is neither a loose object nor in a pack
+	ErrObjectNotFound = errors.New("object not found")
+
+	// ErrHashMismatch is returned when the content of an object does not match its hash
+	ErrHashMismatch = errors.New("object hash mismatch")
+)
+
 type ObjectType string
 
 const (
@@ -33,7 +41,7 @@ const (
 )
 
 type Object struct {
-	Hash            string
+	Hash            ObjectID
 	LocationType    ObjectLocationType
 	PackFile        string // only if LocationType == LOCATION_PACK
 	Offset          int64  // only if LocationType == LOCATION_PACK
@@ -42,7 +50,7 @@ type Object struct {
 	ContentLen      int
 	DeltaOffset     int64
 	DeltaApplied    bool
-	DeltaReference  string
+	DeltaReference  ObjectID
 	DeltaContent    []byte
 	DeltaType       ObjectType
 	DeltaContentLen int
@@ -68,24 +76,38 @@ func (o Object) GetType() string {
 }
 
 // OpenObject returns a parsed object
-// TODO: string? or another return type?
-func (repo Repository) OpenObject(hash string) (Object, error) {
+func (repo Repository) OpenObject(hash ObjectID) (Object, error) {
+	object, err := repo.lookupObject(hash)
+	if err != nil {
+		return object, err
+	}
+
+	return repo.readObject(object)
+}
+
+// lookupObject returns the location of an object: packed objects are searched first, as git does, then loose ones
+func (repo Repository) lookupObject(hash ObjectID) (Object, error) {
+	object, ok, err := repo.lookupPackedObject(hash)
+	if err != nil || ok {
+		return object, err
+	}
+
+	if _, err := os.Stat(repo.looseObjectPath(hash)); err == nil {
+		return Object{Hash: hash, LocationType: LOCATION_FILE}, nil
+	}
+
+	return Object{}, fmt.Errorf("%w: %s", ErrObjectNotFound, hash)
+}
+
+// readObject reads an object from its location, as returned by lookupObject
+func (repo Repository) readObject(object Object) (Object, error) {
 	var objectType ObjectType
 	var objectLen int
 	var deltaOffset int64
-	var deltaRef string
+	var deltaRef ObjectID
 	var objectBytes []byte
 	var err error
 
-	// log.Printf("OpenObject(%s)", hash)
-
-	deltaOffset = 0
-
-	object, ok := repo.Objects[hash]
-	if !ok {
-		return object, fmt.Errorf("could not find object with hash = %s", hash)
-	}
-
 	switch object.LocationType {
 	case LOCATION_FILE:
 		if objectType, objectLen, objectBytes, err = repo.OpenFileObject(object.Hash); err != nil {
@@ -97,7 +119,7 @@ func (repo Repository) OpenObject(hash string) (Object, error) {
 			return Object{}, err
 		}
 	default:
-		panic(fmt.Sprintf("unknown object location type: %d", object.LocationType))
+		return Object{}, fmt.Errorf("unknown object location type: %d", object.LocationType)
 	}
 
 	// TODO: patch object instead of creating a new one
@@ -116,13 +138,14 @@ func (repo Repository) OpenObject(hash string) (Object, error) {
 }
 
 // OpenFileObject attemds to open an object file by its hash and returns its type, len, contents or an error
-func (repo Repository) OpenFileObject(hash string) (ObjectType, int, []byte, error) {
+func (repo Repository) OpenFileObject(hash ObjectID) (ObjectType, int, []byte, error) {
 	objectType := OBJECT_TYPE_UNKNOWN
 
-	file, err := os.Open(path.Join(repo.GetObjectsDir(), hash[0:2], hash[2:]))
+	file, err := os.Open(repo.looseObjectPath(hash))
 	if err != nil {
 		return OBJECT_TYPE_UNKNOWN, 0, []byte{}, err
 	}
+	defer file.Close()
 
 	reader, err := zlib.NewReader(file)
 	if err != nil {
@@ -134,15 +157,20 @@ func (repo Repository) OpenFileObject(hash string) (ObjectType, int, []byte, err
 		return OBJECT_TYPE_UNKNOWN, 0, []byte{}, err
 	}
 
-	hashCheck := fmt.Sprintf("%x", sha1.Sum(data))
-	if hashCheck != hash {
-		return OBJECT_TYPE_UNKNOWN, 0, []byte{}, fmt.Errorf("invalid content hash")
+	if hash.Format().Sum(data) != hash {
+		return OBJECT_TYPE_UNKNOWN, 0, []byte{}, fmt.Errorf("%w: %s", ErrHashMismatch, hash)
 	}
 
 	idx := bytes.Index(data, []byte{0})
+	if idx < 0 {
+		return OBJECT_TYPE_UNKNOWN, 0, []byte{}, fmt.Errorf("invalid object header: %s", hash)
+	}
 	header := data[:idx]
 
 	parts := strings.Split(string(header), " ")
+	if len(parts) != 2 {
+		return OBJECT_TYPE_UNKNOWN, 0, []byte{}, fmt.Errorf("invalid object header: %s", hash)
+	}
 	contentSize, err := strconv.Atoi(parts[1])
 	if err != nil {
 		return OBJECT_TYPE_UNKNOWN, 0, []byte{}, err
@@ -152,16 +180,31 @@ func (repo Repository) OpenFileObject(hash string) (ObjectType, int, []byte, err
 		return OBJECT_TYPE_UNKNOWN, 0, []byte{}, fmt.Errorf("invalid content size")
 	}
 
-	switch parts[0] {
+	if objectType, err = parseObjectType(parts[0]); err != nil {
+		return OBJECT_TYPE_UNKNOWN, 0, []byte{}, err
+	}
+
+	return objectType, contentSize, data[idx+1:], nil
+}
+
+// looseObjectPath returns the path of a loose object file, named after its hash
+func (repo Repository) looseObjectPath(hash ObjectID) string {
+	hexHash := hash.String()
+	return path.Join(repo.GetObjectsDir(), hexHash[0:2], hexHash[2:])
+}
+
+// parseObjectType parses the type of a loose object, as found in its header
+func parseObjectType(name string) (ObjectType, error) {
+	switch name {
 	case "blob":
-		objectType = OBJECT_TYPE_BLOB
+		return OBJECT_TYPE_BLOB, nil
 	case "commit":
-		objectType = OBJECT_TYPE_COMMIT
+		return OBJECT_TYPE_COMMIT, nil
 	case "tree":
-		objectType = OBJECT_TYPE_TREE
-	default:
-		panic(fmt.Sprintf("unknown object type: %s", parts[0]))
+		return OBJECT_TYPE_TREE, nil
+	case "tag":
+		return OBJECT_TYPE_TAG, nil
 	}
 
-	return objectType, contentSize, data[idx+1:], nil
+	return OBJECT_TYPE_UNKNOWN, fmt.Errorf("unknown object type: %s", name)
 }
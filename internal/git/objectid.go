@@ -0,0 +1,165 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strings"
+)
+
+// ObjectFormat is the hash algorithm naming the objects of a repository
+type ObjectFormat uint8
+
+const (
+	OBJECT_FORMAT_SHA1 ObjectFormat = iota
+	OBJECT_FORMAT_SHA256
+)
+
+const (
+	SHA1_HASH_SIZE   = 20
+	SHA256_HASH_SIZE = 32
+	MAX_HASH_SIZE    = SHA256_HASH_SIZE
+)
+
+// ParseObjectFormat returns the format of the given name, as found in extensions.objectformat
+func ParseObjectFormat(name string) (ObjectFormat, error) {
+	switch strings.ToLower(name) {
+	case "sha1":
+		return OBJECT_FORMAT_SHA1, nil
+	case "sha256":
+		return OBJECT_FORMAT_SHA256, nil
+	}
+
+	return OBJECT_FORMAT_SHA1, fmt.Errorf("unknown object format: %s", name)
+}
+
+func (format ObjectFormat) String() string {
+	switch format {
+	case OBJECT_FORMAT_SHA1:
+		return "sha1"
+	case OBJECT_FORMAT_SHA256:
+		return "sha256"
+	}
+
+	return "unknown"
+}
+
+// Size returns the size in bytes of the format's hashes
+func (format ObjectFormat) Size() int {
+	if format == OBJECT_FORMAT_SHA256 {
+		return SHA256_HASH_SIZE
+	}
+	return SHA1_HASH_SIZE
+}
+
+// HashId returns the number identifying the format in the headers of multi-pack-indexes, commit-graphs and reverse
+// indexes
+func (format ObjectFormat) HashId() uint32 {
+	if format == OBJECT_FORMAT_SHA256 {
+		return 2
+	}
+	return 1
+}
+
+// New returns a hash computing object IDs of the format
+func (format ObjectFormat) New() hash.Hash {
+	if format == OBJECT_FORMAT_SHA256 {
+		return sha256.New()
+	}
+	return sha1.New()
+}
+
+// Sum returns the ID of the given data, which must include the object header
+func (format ObjectFormat) Sum(data []byte) ObjectID {
+	id := ObjectID{format: format}
+
+	h := format.New()
+	h.Write(data)
+	copy(id.hash[:], h.Sum(nil))
+
+	return id
+}
+
+// ObjectID is the binary hash of an object. It is comparable, so it can be used as a map key. The zero value is the
+// null hash, which names no object.
+type ObjectID struct {
+	hash   [MAX_HASH_SIZE]byte // only the format's size is used
+	format ObjectFormat
+}
+
+// NewObjectID returns the ID of the given binary hash
+func NewObjectID(format ObjectFormat, raw []byte) (ObjectID, error) {
+	id := ObjectID{format: format}
+
+	if len(raw) != format.Size() {
+		return ObjectID{}, fmt.Errorf("invalid %s hash length: %d", format, len(raw))
+	}
+	copy(id.hash[:], raw)
+
+	return id, nil
+}
+
+// ParseObjectID parses a full hex hash. The hash algorithm is found from its length.
+func ParseObjectID(value string) (ObjectID, error) {
+	for _, format := range []ObjectFormat{OBJECT_FORMAT_SHA1, OBJECT_FORMAT_SHA256} {
+		if len(value) != 2*format.Size() {
+			continue
+		}
+
+		raw, err := hex.DecodeString(value)
+		if err != nil {
+			break
+		}
+
+		return NewObjectID(format, raw)
+	}
+
+	return ObjectID{}, fmt.Errorf("invalid object id: %s", value)
+}
+
+// Format returns the hash algorithm of the ID
+func (id ObjectID) Format() ObjectFormat {
+	return id.format
+}
+
+// Bytes returns the binary hash
+func (id ObjectID) Bytes() []byte {
+	return id.hash[:id.format.Size()]
+}
+
+// String returns the hex hash
+func (id ObjectID) String() string {
+	return hex.EncodeToString(id.Bytes())
+}
+
+// IsZero returns true for the null hash
+func (id ObjectID) IsZero() bool {
+	return id.hash == [MAX_HASH_SIZE]byte{}
+}
+
+// Compare returns -1, 0 or +1 as the ID sorts before, equal to or after the other, as in pack indexes
+func (id ObjectID) Compare(other ObjectID) int {
+	return bytes.Compare(id.Bytes(), other.Bytes())
+}
+
+// HasPrefix returns true if the hex hash starts with the given, possibly odd length, hex prefix
+func (id ObjectID) HasPrefix(prefix string) bool {
+	return strings.HasPrefix(id.String(), strings.ToLower(prefix))
+}
+
+func (id ObjectID) MarshalText() ([]byte, error) {
+	return []byte(id.String()), nil
+}
+
+func (id *ObjectID) UnmarshalText(text []byte) error {
+	parsed, err := ParseObjectID(string(text))
+	if err != nil {
+		return err
+	}
+
+	*id = parsed
+	return nil
+}
@@ -0,0 +1,206 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ObjectHeader is the type and size of an object, as known before reading its content. Deltas are resolved: Type
+// is the type of the resulting object, never a delta type.
+type ObjectHeader struct {
+	Hash ObjectID
+	Type ObjectType
+	Size int64
+}
+
+// objectReader reads an object's content from an underlying reader, checking its size and, if set, its hash once
+// fully read. Errors reading packed objects are *ErrCorruptPack.
+type objectReader struct {
+	reader  io.Reader
+	closers []io.Closer
+	size    int64
+	read    int64
+
+	hash     hash.Hash
+	expected ObjectID
+
+	pack   string // pack & offset of the object, if packed
+	offset int64
+}
+
+func (r *objectReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+
+	if r.read > r.size {
+		err = fmt.Errorf("invalid content size: more than %d bytes", r.size)
+	} else if err == io.EOF {
+		if r.read != r.size {
+			err = fmt.Errorf("invalid content size: %d != %d", r.read, r.size)
+		} else if r.hash != nil && !bytes.Equal(r.hash.Sum(nil), r.expected.Bytes()) {
+			return n, fmt.Errorf("%w: %s", ErrHashMismatch, r.expected)
+		}
+	}
+
+	if err != nil && err != io.EOF && r.pack != "" {
+		err = &ErrCorruptPack{Pack: r.pack, Offset: r.offset, Err: err}
+	}
+
+	return n, err
+}
+
+func (r *objectReader) Close() error {
+	var err error
+
+	for _, closer := range r.closers {
+		if closeErr := closer.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// OpenObjectReader returns the header of an object and a reader of its content, which must be closed. Objects are
+// inflated as they are read, so they are never held in memory as a whole; only delta bases are.
+func (repo Repository) OpenObjectReader(hash ObjectID) (ObjectHeader, io.ReadCloser, error) {
+	object, err := repo.lookupObject(hash)
+	if err != nil {
+		return ObjectHeader{}, nil, err
+	}
+
+	switch object.LocationType {
+	case LOCATION_FILE:
+		return repo.openFileObjectReader(object.Hash)
+	case LOCATION_PACK:
+		return repo.openPackObjectReader(object)
+	}
+
+	return ObjectHeader{}, nil, fmt.Errorf("unknown object location type: %d", object.LocationType)
+}
+
+// openFileObjectReader opens a loose object, whose hash is checked once fully read
+func (repo Repository) openFileObjectReader(objectHash ObjectID) (ObjectHeader, io.ReadCloser, error) {
+	file, err := os.Open(repo.looseObjectPath(objectHash))
+	if err != nil {
+		return ObjectHeader{}, nil, err
+	}
+
+	zlibReader, err := zlib.NewReader(file)
+	if err != nil {
+		file.Close()
+		return ObjectHeader{}, nil, err
+	}
+
+	reader := bufio.NewReader(zlibReader)
+
+	header, err := reader.ReadString(0)
+	if err != nil {
+		zlibReader.Close()
+		file.Close()
+		return ObjectHeader{}, nil, fmt.Errorf("invalid object header: %s", objectHash)
+	}
+
+	typeName, sizeValue, _ := strings.Cut(strings.TrimSuffix(header, "\x00"), " ")
+
+	objectType, err := parseObjectType(typeName)
+	if err != nil {
+		zlibReader.Close()
+		file.Close()
+		return ObjectHeader{}, nil, err
+	}
+
+	size, err := strconv.ParseInt(sizeValue, 10, 64)
+	if err != nil {
+		zlibReader.Close()
+		file.Close()
+		return ObjectHeader{}, nil, fmt.Errorf("invalid object size: %s", sizeValue)
+	}
+
+	hasher := objectHash.Format().New()
+	hasher.Write([]byte(header))
+
+	return ObjectHeader{Hash: objectHash, Type: objectType, Size: size}, &objectReader{
+		reader:   io.TeeReader(reader, hasher),
+		closers:  []io.Closer{zlibReader, file},
+		size:     size,
+		hash:     hasher,
+		expected: objectHash,
+	}, nil
+}
+
+// openPackObjectReader opens a packed object, read from the pack's mapped data. Deltas are inflated, and applied to
+// their base as they are read.
+func (repo Repository) openPackObjectReader(object Object) (ObjectHeader, io.ReadCloser, error) {
+	corrupt := func(err error) error {
+		return &ErrCorruptPack{Pack: object.PackFile, Offset: object.Offset, Err: err}
+	}
+
+	reader, err := repo.openPackReader(object)
+	if err != nil {
+		return ObjectHeader{}, nil, err
+	}
+
+	objectType, size, deltaOffset, deltaRef, err := readPackObjectHeader(reader, repo.ObjectFormat)
+	if err != nil {
+		return ObjectHeader{}, nil, corrupt(err)
+	}
+
+	zlibReader, err := zlib.NewReader(reader)
+	if err != nil {
+		return ObjectHeader{}, nil, corrupt(err)
+	}
+
+	if objectType != OBJECT_TYPE_OFS_DELTA && objectType != OBJECT_TYPE_REF_DELTA {
+		return ObjectHeader{Hash: object.Hash, Type: objectType, Size: int64(size)}, &objectReader{
+			reader:  zlibReader,
+			closers: []io.Closer{zlibReader},
+			size:    int64(size),
+			pack:    object.PackFile,
+			offset:  object.Offset,
+		}, nil
+	}
+
+	// deltas are small: they are read as a whole, then applied to their base object as the result is read. The
+	// buffer grows as data is inflated, rather than trusting the size of the header.
+	delta, err := io.ReadAll(io.LimitReader(zlibReader, int64(size)+1))
+	zlibReader.Close()
+	if err != nil {
+		return ObjectHeader{}, nil, corrupt(err)
+	}
+	if len(delta) != size {
+		return ObjectHeader{}, nil, corrupt(fmt.Errorf("invalid size: %d != %d", len(delta), size))
+	}
+
+	baseObject, err := repo.openDeltaBase(Object{
+		Hash:           object.Hash,
+		LocationType:   LOCATION_PACK,
+		PackFile:       object.PackFile,
+		Offset:         object.Offset,
+		Type:           objectType,
+		DeltaOffset:    deltaOffset,
+		DeltaReference: deltaRef,
+	})
+	if err != nil {
+		return ObjectHeader{}, nil, err
+	}
+
+	deltaReader, err := newDeltaReader(baseObject.Content, delta)
+	if err != nil {
+		return ObjectHeader{}, nil, corrupt(err)
+	}
+
+	return ObjectHeader{Hash: object.Hash, Type: baseObject.Type, Size: deltaReader.size}, &objectReader{
+		reader: deltaReader,
+		size:   deltaReader.size,
+		pack:   object.PackFile,
+		offset: object.Offset,
+	}, nil
+}
@@ -2,46 +2,46 @@ package git
 
 import (
 	"fmt"
+	"math/bits"
 	"os"
 	"path"
+	"sort"
 	"strings"
 )
 
-// List all known objects from "<repo>/.git/objects/??/*"
-func (repo Repository) ListFileObjects() ([]Object, error) {
-	knownObjects := make([]Object, 0)
-	for n := range 256 {
-		hashPart := fmt.Sprintf("%02x", n)
+const (
+	// minimum length of an abbreviated object hash
+	MIN_ABBREV_LEN = 4
 
-		dirPath := path.Join(repo.Path, ".git/objects", hashPart)
-		stat, err := os.Stat(dirPath)
-		if err != nil || !stat.IsDir() {
-			continue
-		}
+	// minimum length of abbreviated hashes in output, as git's default for small repositories
+	DEFAULT_ABBREV_LEN = 7
+)
 
-		// List all objects
-		entries, err := os.ReadDir(dirPath)
-		if err != nil {
-			return []Object{}, err
-		}
-		for _, entry := range entries {
-			hash := hashPart + entry.Name()
-			knownObjects = append(knownObjects, Object{
-				Hash:         hash,
-				LocationType: LOCATION_FILE,
-			})
-		}
+// AmbiguousObjectError is returned when an abbreviated hash matches more than one object
+type AmbiguousObjectError struct {
+	Prefix     string
+	Candidates []Object // with their Hash & Type set
+}
+
+func (e *AmbiguousObjectError) Error() string {
+	out := fmt.Sprintf("short object ID %s is ambiguous\nThe candidates are:", e.Prefix)
+
+	for _, candidate := range e.Candidates {
+		out += fmt.Sprintf("\n  %s %s", candidate.Hash, candidate.Type)
 	}
 
-	return knownObjects, nil
+	return out
 }
 
-// List all objects that can be extracted from "<repo>/.git/objects/pack/*"
-func (repo Repository) ListPackedObjects() ([]Object, error) {
-	knownObjects := make([]Object, 0)
+// openPackIndexes opens the .idx and .pack files of every pack of "<repo>/.git/objects/pack". It returns them by pack file name,
+// along with the pack file names in lookup order.
+func (repo Repository) openPackIndexes() (map[string]*PackIndex, []string, error) {
+	packs := make(map[string]*PackIndex)
+	packFiles := make([]string, 0)
+
 	dirEntries, err := os.ReadDir(repo.GetPackDir())
 	if err != nil {
-		return []Object{}, fmt.Errorf("could not open pack directory: %s", repo.GetPackDir())
+		return nil, nil, fmt.Errorf("could not open pack directory: %s", repo.GetPackDir())
 	}
 
 	for _, dirEntry := range dirEntries {
@@ -52,57 +52,234 @@ func (repo Repository) ListPackedObjects() ([]Object, error) {
 		idxDirEntry := dirEntry.Name()
 
 		// check the .idx file has a .pack counterpart
-		dirEntryBase := strings.TrimSuffix(idxDirEntry, ".idx")
-		packDirEntry := dirEntryBase + ".pack"
+		packDirEntry := strings.TrimSuffix(idxDirEntry, ".idx") + ".pack"
 
 		packPath := path.Join(repo.GetPackDir(), packDirEntry)
-		_, err := os.Stat(packPath)
+		if _, err := os.Stat(packPath); err != nil {
+			return nil, nil, fmt.Errorf("could not stat pack: %s", packPath)
+		}
+
+		index, err := repo.OpenPackIndex(idxDirEntry, packDirEntry)
 		if err != nil {
-			return []Object{}, fmt.Errorf("could not stat pack: %s", packPath)
+			for _, opened := range packs {
+				opened.Close()
+			}
+			return nil, nil, err
+		}
+
+		packs[packDirEntry] = index
+		packFiles = append(packFiles, packDirEntry)
+	}
+
+	return packs, packFiles, nil
+}
+
+// uncoveredPacks returns, in lookup order, the indexes of packs which are not covered by the multi-pack-index
+func (repo Repository) uncoveredPacks() []*PackIndex {
+	indexes := make([]*PackIndex, 0, len(repo.packFiles))
+
+	for _, packFile := range repo.packFiles {
+		if repo.MultiPackIndex == nil || !repo.MultiPackIndex.Contains(packFile) {
+			indexes = append(indexes, repo.Packs[packFile])
+		}
+	}
+
+	return indexes
+}
+
+// lookupPackedObject searches for an object in the multi-pack-index, then in the other packs
+func (repo Repository) lookupPackedObject(hash ObjectID) (Object, bool, error) {
+	if repo.MultiPackIndex != nil {
+		if object, ok, err := repo.MultiPackIndex.Lookup(hash); ok || err != nil {
+			return object, ok, err
+		}
+	}
+
+	for _, index := range repo.uncoveredPacks() {
+		if object, ok, err := index.Lookup(hash); ok || err != nil {
+			return object, ok, err
+		}
+	}
+
+	return Object{}, false, nil
+}
+
+// ForEachObject calls fn for every object of the repository, loose or packed, until it returns an error. Objects
+// stored more than once are only given once, at the location they are read from.
+func (repo Repository) ForEachObject(fn func(object Object) error) error {
+	if midx := repo.MultiPackIndex; midx != nil {
+		for n := range midx.Len() {
+			object, err := midx.object(n)
+			if err != nil {
+				return err
+			}
+			if err := fn(object); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, index := range repo.uncoveredPacks() {
+		for n := range index.Len() {
+			object, err := index.object(n)
+			if err != nil {
+				return err
+			}
+
+			found, _, err := repo.lookupPackedObject(object.Hash)
+			if err != nil {
+				return err
+			}
+			if found.PackFile != object.PackFile || found.Offset != object.Offset {
+				continue
+			}
+
+			if err := fn(object); err != nil {
+				return err
+			}
 		}
+	}
 
-		objects, err := repo.OpenPackIdx(idxDirEntry, packDirEntry)
+	// loose objects are in directories named after their hash' first byte
+	for n := range 256 {
+		hashPart := fmt.Sprintf("%02x", n)
+
+		entries, err := os.ReadDir(path.Join(repo.GetObjectsDir(), hashPart))
 		if err != nil {
-			return []Object{}, err
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
 		}
 
-		for _, object := range objects {
-			if object.Type == OBJECT_TYPE_UNKNOWN {
+		for _, entry := range entries {
+			// skip temporary files and anything else not named after a hash
+			hash, err := ParseObjectID(hashPart + entry.Name())
+			if err != nil {
+				continue
+			}
+
+			_, packed, err := repo.lookupPackedObject(hash)
+			if err != nil {
+				return err
+			}
+			if packed {
 				continue
 			}
 
-			knownObjects = append(knownObjects, object)
+			if err := fn(Object{Hash: hash, LocationType: LOCATION_FILE}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// FindObjectsByPrefix returns the hashes of all objects, loose or packed, starting with the given hex prefix
+func (repo Repository) FindObjectsByPrefix(prefix string) ([]ObjectID, error) {
+	found := make(map[ObjectID]bool)
+
+	if len(prefix) < 2 {
+		return []ObjectID{}, fmt.Errorf("abbreviated hash is too short: %s", prefix)
+	}
+
+	// loose objects are found in the directory named after their hash' first byte
+	entries, err := os.ReadDir(path.Join(repo.GetObjectsDir(), prefix[0:2]))
+	if err != nil && !os.IsNotExist(err) {
+		return []ObjectID{}, err
+	}
+	for _, entry := range entries {
+		hash, err := ParseObjectID(prefix[0:2] + entry.Name())
+		if err == nil && hash.HasPrefix(prefix) {
+			found[hash] = true
 		}
 	}
 
-	return knownObjects, nil
+	// pack indexes are sorted by hash
+	if midx := repo.MultiPackIndex; midx != nil {
+		for _, hash := range searchPrefix(midx.Len(), prefix, midx.HashAt) {
+			found[hash] = true
+		}
+	}
+	for _, index := range repo.uncoveredPacks() {
+		for _, hash := range searchPrefix(index.Len(), prefix, index.HashAt) {
+			found[hash] = true
+		}
+	}
+
+	hashes := make([]ObjectID, 0, len(found))
+	for hash := range found {
+		hashes = append(hashes, hash)
+	}
+	sort.Slice(hashes, func(i, j int) bool {
+		return hashes[i].Compare(hashes[j]) < 0
+	})
+
+	return hashes, nil
 }
 
-// ListObjects lists and returns both file & pack objects
-func (repo Repository) ListObjects() (map[string]Object, error) {
-	var fileObjects []Object
-	var packedObjects []Object
-	var err error
+// ResolvePrefix returns the full hash of the single object starting with the given abbreviated hash. If more than
+// one object matches, an *AmbiguousObjectError listing them is returned.
+func (repo Repository) ResolvePrefix(prefix string) (ObjectID, error) {
+	prefix = strings.ToLower(prefix)
+
+	if len(prefix) < MIN_ABBREV_LEN {
+		return ObjectID{}, fmt.Errorf("abbreviated hash is too short (minimum is %d): %s", MIN_ABBREV_LEN, prefix)
+	}
+	if len(prefix) > 2*repo.ObjectFormat.Size() || !isHex(prefix) {
+		return ObjectID{}, fmt.Errorf("invalid abbreviated hash: %s", prefix)
+	}
 
-	objects := make(map[string]Object)
+	hashes, err := repo.FindObjectsByPrefix(prefix)
+	if err != nil {
+		return ObjectID{}, err
+	}
 
-	if fileObjects, err = repo.ListFileObjects(); err != nil {
-		return map[string]Object{}, err
+	switch len(hashes) {
+	case 0:
+		return ObjectID{}, fmt.Errorf("%w: %s", ErrObjectNotFound, prefix)
+	case 1:
+		return hashes[0], nil
 	}
 
-	for _, fileObject := range fileObjects {
-		objects[fileObject.Hash] = fileObject
+	ambiguousErr := &AmbiguousObjectError{Prefix: prefix}
+	for _, hash := range hashes {
+		candidate := Object{Hash: hash, Type: OBJECT_TYPE_UNKNOWN}
+		if object, err := repo.openResolvedObject(hash); err == nil {
+			candidate.Type = object.Type
+		}
+		ambiguousErr.Candidates = append(ambiguousErr.Candidates, candidate)
 	}
 
-	if packedObjects, err = repo.ListPackedObjects(); err != nil {
-		return map[string]Object{}, err
+	return ObjectID{}, ambiguousErr
+}
+
+// AbbreviateHash returns the shortest unique prefix of a hash, of at least a length growing with the number of
+// packed objects as git does. The null hash is abbreviated to zeros.
+func (repo Repository) AbbreviateHash(hash ObjectID) string {
+	count := 0
+	if repo.MultiPackIndex != nil {
+		count += repo.MultiPackIndex.Len()
+	}
+	for _, index := range repo.uncoveredPacks() {
+		count += index.Len()
 	}
 
-	for _, packObject := range packedObjects {
-		objects[packObject.Hash] = packObject
+	// 2^n objects are expected to collide on n/2 bits, and there are 4 bits per hex digit
+	length := max((bits.Len(uint(count))+1)/2, DEFAULT_ABBREV_LEN)
+
+	hexHash := hash.String()
+	if hash.IsZero() {
+		return hexHash[:length]
 	}
 
-	repo.Objects = objects
+	for ; length < len(hexHash); length++ {
+		hashes, err := repo.FindObjectsByPrefix(hexHash[:length])
+		if err != nil || len(hashes) <= 1 {
+			break
+		}
+	}
 
-	return objects, nil
+	return hexHash[:length]
 }
@@ -1,123 +1,58 @@
 package git
 
 import (
-	"bufio"
 	"bytes"
 	"compress/zlib"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path"
-	"reflect"
 )
 
 const (
-	HASH_SIZE = 20
+	// size of the header of pack files: signature, version and number of objects
+	PACK_HEADER_SIZE = 12
 )
 
-// OpenPackIdx opens an parse an packed .idx file
-func (repo Repository) OpenPackIdx(idxDirEntry, packDirEntry string) ([]Object, error) {
-	var fileFD *os.File
-	var err error
-
-	var entriesNum uint32
-	offsets := make(map[string]int64)
-	hashes := make([]string, 0)
-	objects := make([]Object, 0)
-
-	// ts_start := time.Now().UnixMilli()
-
-	dirEntryPath := path.Join(repo.GetPackDir(), idxDirEntry)
-
-	if fileFD, err = os.Open(dirEntryPath); err != nil {
-		return objects, err
-	}
-
-	reader := bufio.NewReader(fileFD)
-
-	header := make([]byte, 4)
-	if _, err = reader.Read(header); err != nil {
-		return objects, err
-	}
-	if !reflect.DeepEqual(header, []byte{255, 116, 79, 99}) {
-		panic("Invalid header for a pack file")
-	}
-
-	version := make([]byte, 4)
-	if _, err = reader.Read(version); err != nil {
-		return objects, err
-	}
-	if !reflect.DeepEqual(version, []byte{0, 0, 0, 2}) {
-		panic("Invalid version for a pack file")
-	}
-
-	for _ = range 256 {
-		buf := make([]byte, 4)
+// ErrUnsupportedVersion is returned for pack indexes, multi-pack-indexes, reverse indexes and commit-graphs of an
+// unknown version
+var ErrUnsupportedVersion = errors.New("unsupported version")
 
-		if _, err = reader.Read(buf); err != nil {
-			return objects, err
-		}
+// ErrCorruptPack is returned when the object at an offset of a pack can not be read: truncated data, invalid header,
+// size or delta... It is also returned for truncated or invalid pack indexes and multi-pack-indexes.
+type ErrCorruptPack struct {
+	Pack   string
+	Offset int64 // 0 if the error is not about an object, objects following the pack header
+	Err    error // underlying error, if any
+}
 
-		newEntriesNum := binary.BigEndian.Uint32(buf)
-		entriesNum = newEntriesNum
+func (e *ErrCorruptPack) Error() string {
+	message := "corrupt pack " + e.Pack
+	if e.Offset != 0 {
+		message += fmt.Sprintf(" at offset %d", e.Offset)
 	}
-
-	for _ = range entriesNum {
-		buf := make([]byte, HASH_SIZE)
-		if _, err := io.ReadFull(reader, buf); err != nil {
-			return objects, err
-		}
-		hashes = append(hashes, fmt.Sprintf("%x", buf))
-	}
-
-	// CRCs
-	// for _ = range entriesNum {
-	// 	crc := make([]byte, 4)
-	// 	if _, err := io.ReadFull(reader, crc); err != nil {
-	// 		return objects, err
-	// 	}
-	// }
-
-	// Skipping reading all CRCs, as we're not using them
-	reader.Discard(int(4 * entriesNum))
-
-	// offsets
-	for n := range entriesNum {
-		offset := make([]byte, 4)
-		if _, err := io.ReadFull(reader, offset); err != nil {
-			return objects, err
-		}
-		offsets[hashes[n]] = int64(binary.BigEndian.Uint32(offset))
-
-		if offsets[hashes[n]]&0x80000000 != 0 {
-			panic("large offsets are not supported")
-		}
-
-		objects = append(objects, Object{
-			Hash:         hashes[n],
-			LocationType: LOCATION_PACK,
-			PackFile:     packDirEntry,
-			Offset:       offsets[hashes[n]],
-		})
+	if e.Err != nil {
+		message += ": " + e.Err.Error()
 	}
+	return message
+}
 
-	// log.Printf("parsed %s after %d ms\n", packDirEntry, time.Now().UnixMilli()-ts_start)
-
-	return objects, nil
+func (e *ErrCorruptPack) Unwrap() error {
+	return e.Err
 }
 
-// ReadPackObject reads an object from given reader
-func (repo Repository) ReadPackObject(fileFD *os.File, reader *bufio.Reader) (ObjectType, int, int64, string, []byte, error) {
+// readPackObjectHeader reads the header of a packed object: its type and size, then the offset or hash of the base
+// object for deltas
+func readPackObjectHeader(reader *bytes.Reader, format ObjectFormat) (ObjectType, int, int64, ObjectID, error) {
 	objectType := OBJECT_TYPE_UNKNOWN
 
 	deltaOffset := int64(0)
-	deltaReference := ""
+	deltaReference := ObjectID{}
 
 	// extract type & size
 	b, err := reader.ReadByte()
 	if err != nil {
-		return objectType, 0, 0, "", []byte{}, err
+		return objectType, 0, 0, ObjectID{}, err
 	}
 
 	packedObjectType := int((b & 0x7f) >> 4)
@@ -129,7 +64,10 @@ func (repo Repository) ReadPackObject(fileFD *os.File, reader *bufio.Reader) (Ob
 	for b&0x80 == 0x80 {
 		b, err = reader.ReadByte()
 		if err != nil {
-			panic(err)
+			return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, err
+		}
+		if shift > 56 {
+			return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, fmt.Errorf("invalid object size")
 		}
 
 		packedObjectSize |= int(b&0x7F) << shift
@@ -149,171 +87,287 @@ func (repo Repository) ReadPackObject(fileFD *os.File, reader *bufio.Reader) (Ob
 		objectType = OBJECT_TYPE_OFS_DELTA
 	case 7:
 		objectType = OBJECT_TYPE_REF_DELTA
+	default:
+		return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, fmt.Errorf("invalid object type: %d", packedObjectType)
 	}
 
 	// Note: In case of OBJECT_TYPE_OFS_DELTA, we need to store the offset,
 	// before continuing reading stuff; for OBJECT_TYPE_REF_DELTA, it is
 	// the reference of base object the delta will be applied on.
 	if objectType == OBJECT_TYPE_OFS_DELTA {
-		deltaOffset = ReadVariantInteger(reader, true)
+		if deltaOffset, err = ReadVariantInteger(reader, true); err != nil {
+			return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, err
+		}
 	}
 
 	if objectType == OBJECT_TYPE_REF_DELTA {
-		data := make([]byte, 20)
+		data := make([]byte, format.Size())
 
 		_, err := io.ReadFull(reader, data)
 		if err != nil {
-			return OBJECT_TYPE_UNKNOWN, 0, 0, "", []byte{}, err
+			return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, err
 		}
 
-		deltaReference = fmt.Sprintf("%x", data)
+		if deltaReference, err = NewObjectID(format, data); err != nil {
+			return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, err
+		}
+	}
+
+	return objectType, packedObjectSize, deltaOffset, deltaReference, nil
+}
+
+// ReadPackObject reads an object from given reader
+func (repo Repository) ReadPackObject(reader *bytes.Reader) (ObjectType, int, int64, ObjectID, []byte, error) {
+	objectType, packedObjectSize, deltaOffset, deltaReference, err := readPackObjectHeader(reader, repo.ObjectFormat)
+	if err != nil {
+		return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, []byte{}, err
 	}
 
 	zlibReader, err := zlib.NewReader(reader)
 	if err != nil {
-		return OBJECT_TYPE_UNKNOWN, 0, 0, "", []byte{}, err
+		return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, []byte{}, err
 	}
 
 	data, err := io.ReadAll(zlibReader)
 	if err != nil {
-		return OBJECT_TYPE_UNKNOWN, 0, 0, "", []byte{}, err
+		return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, []byte{}, err
 	}
 
 	if len(data) != int(packedObjectSize) {
-		panic(fmt.Sprintf("error while parsing packed object: invalid size: %d != %d", len(data), packedObjectSize))
+		return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, []byte{}, fmt.Errorf("invalid size: %d != %d", len(data), packedObjectSize)
 	}
 
 	return objectType, len(data), deltaOffset, deltaReference, data, err
 }
 
 // OpenPackObject opens a pack file and attempts to retrieve a given object by its hash and offset
-// It returns: Object's type (commit, blob...), object's size, object's contents or an error
-func (repo Repository) OpenPackObject(object Object) (ObjectType, int, int64, string, []byte, error) {
+// It returns: Object's type (commit, blob...), object's size, object's contents or an error. Errors met while reading
+// the object are *ErrCorruptPack.
+func (repo Repository) OpenPackObject(object Object) (ObjectType, int, int64, ObjectID, []byte, error) {
 	// To process an object embedded in a packfile, we must:
 	// - move to correct offset
 	// - extract object type
 	// - extract compressed object size
 	// - retrieve object's compressed data
 
-	fileFD, err := os.Open(path.Join(repo.GetPackDir(), object.PackFile))
+	reader, err := repo.openPackReader(object)
 	if err != nil {
-		panic(err)
+		return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, []byte{}, err
 	}
 
-	fileFD.Seek(int64(object.Offset), 0)
-
-	reader := bufio.NewReader(fileFD)
+	objectType, objectLen, deltaOffset, deltaRef, data, err := repo.ReadPackObject(reader)
+	if err != nil {
+		return OBJECT_TYPE_UNKNOWN, 0, 0, ObjectID{}, []byte{}, &ErrCorruptPack{Pack: object.PackFile, Offset: object.Offset, Err: err}
+	}
 
-	return repo.ReadPackObject(fileFD, reader)
+	return objectType, objectLen, deltaOffset, deltaRef, data, nil
 }
 
-// ApplyDelta retrieves a offset_delta object, retrieves base object, patch base object content and returns the offset_delta patched
-func (repo Repository) ApplyDelta(object Object) Object {
-	var baseObjectHash string
-	var baseObjectOffset int64
+// openPackReader returns a reader of a pack's mapped data, starting at the given object
+func (repo Repository) openPackReader(object Object) (*bytes.Reader, error) {
+	index, ok := repo.Packs[object.PackFile]
+	if !ok {
+		return nil, fmt.Errorf("unknown pack: %s", object.PackFile)
+	}
 
-	if object.Type != OBJECT_TYPE_OFS_DELTA && object.Type != OBJECT_TYPE_REF_DELTA {
-		return object
+	data := index.pack.Data
+	if data == nil {
+		return nil, fmt.Errorf("pack %s is closed", object.PackFile)
+	}
+
+	if object.Offset < PACK_HEADER_SIZE || object.Offset >= int64(len(data)) {
+		return nil, &ErrCorruptPack{Pack: object.PackFile, Offset: object.Offset, Err: fmt.Errorf("offset out of the pack")}
 	}
 
+	return bytes.NewReader(data[object.Offset:]), nil
+}
+
+// openDeltaBase returns the object a delta applies to, with its own deltas applied. Packed bases are kept in the
+// repository's delta base cache, as they are often shared by many deltas.
+func (repo Repository) openDeltaBase(object Object) (Object, error) {
+	var base Object
+	var err error
+
 	switch object.Type {
 	case OBJECT_TYPE_OFS_DELTA:
-		readOffset := object.DeltaOffset
-
-		// We're in the same file. Offset returned is relative to current offset, and then we must return the object at
-		// this area and so one
-		baseObjectOffset = object.Offset - readOffset
+		if object.PackFile == "" {
+			return Object{}, fmt.Errorf("could not find base of offset delta %s", object.Hash)
+		}
 
-		// Retrieve from the repository metadata teh correct commit
-		// TODO: Optimize this
-		for _, repoObject := range repo.Objects {
-			if repoObject.PackFile != object.PackFile {
-				continue
-			}
+		// We're in the same file. Offset returned is relative to current offset. As the multi-pack-index only keeps
+		// a single copy of each object, which can be in another pack, the base object is read directly from there.
+		base = Object{
+			LocationType: LOCATION_PACK,
+			PackFile:     object.PackFile,
+			Offset:       object.Offset - object.DeltaOffset,
+		}
 
-			if repoObject.Offset == baseObjectOffset {
-				baseObjectHash = repoObject.Hash
+		// Retrieve the base object's hash from the pack's reverse index
+		if index, ok := repo.Packs[object.PackFile]; ok {
+			if base.Hash, _, err = index.LookupOffset(repo, base.Offset); err != nil {
+				return Object{}, err
 			}
 		}
 
 	case OBJECT_TYPE_REF_DELTA:
-		baseObjectHash = object.DeltaReference
+		if base, err = repo.lookupObject(object.DeltaReference); err != nil {
+			return Object{}, err
+		}
+
+	default:
+		return Object{}, fmt.Errorf("object %s is not a delta", object.Hash)
 	}
 
-	if baseObjectHash == "" {
-		panic(fmt.Sprintf("could not find repoObject in %s at offset %d", object.PackFile, baseObjectOffset))
+	if base.LocationType == LOCATION_PACK {
+		if cached, ok := repo.DeltaBaseCache.Get(base.PackFile, base.Offset); ok {
+			return cached, nil
+		}
 	}
 
-	baseObject, err := repo.OpenObject(baseObjectHash)
+	baseObject, err := repo.readObject(base)
 	if err != nil {
-		panic(err)
+		return Object{}, err
+	}
+	if baseObject, err = repo.ApplyDelta(baseObject); err != nil {
+		return Object{}, err
 	}
-	baseObject = repo.ApplyDelta(baseObject)
 
-	// Transform the data
-	transformReader := bufio.NewReader(bytes.NewReader(object.Content))
-	_ = ReadVariantIntegerLE(transformReader) // baseObjSize
-	_ = ReadVariantIntegerLE(transformReader) // ObjSizeDest
+	if base.LocationType == LOCATION_PACK {
+		repo.DeltaBaseCache.Add(base.PackFile, base.Offset, baseObject)
+	}
+
+	return baseObject, nil
+}
 
-	destObject := make([]byte, 0)
+// deltaReader applies delta instructions to a base object's content as the result is read, so the result does not
+// need to be held in memory
+type deltaReader struct {
+	base         []byte
+	instructions *bytes.Reader
+	size         int64 // size of the result, as given by the delta
+	read         int64
+	pending      []byte // data of the current instruction not read yet
+}
 
-	for {
-		ch, err := transformReader.ReadByte()
-		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				panic(err)
-			}
-		}
+// newDeltaReader reads the header of a delta and returns a reader of its result
+func newDeltaReader(base, delta []byte) (*deltaReader, error) {
+	instructions := bytes.NewReader(delta)
+
+	baseSize, err := ReadVariantIntegerLE(instructions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delta header: %w", err)
+	}
+	if baseSize != int64(len(base)) {
+		return nil, fmt.Errorf("invalid delta: base size %d != %d", len(base), baseSize)
+	}
+
+	size, err := ReadVariantIntegerLE(instructions)
+	if err != nil {
+		return nil, fmt.Errorf("invalid delta header: %w", err)
+	}
+
+	return &deltaReader{base: base, instructions: instructions, size: size}, nil
+}
 
-		if ch == 0x80 {
-			continue
+// next reads the next instruction: either copy data from the base object, or add new data
+func (r *deltaReader) next() error {
+	ch, err := r.instructions.ReadByte()
+	if err == io.EOF {
+		if r.read != r.size {
+			return fmt.Errorf("invalid delta: result size %d != %d", r.read, r.size)
 		}
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+
+	if (ch & 0x80) != 0 {
+		// copy data from base object
+		vals := make([]byte, 7)
 
-		if (ch & 0x80) != 0 {
-			// copy data from base object
-			vals := make([]byte, 0)
-
-			for i := range 7 {
-				bmask := byte(1 << i)
-				if ch&bmask != 0 {
-					nc, err := transformReader.ReadByte()
-					if err != nil {
-						panic(err)
-					}
-					vals = append(vals, nc)
-				} else {
-					vals = append(vals, 0)
+		for i := range 7 {
+			if ch&byte(1<<i) != 0 {
+				if vals[i], err = r.instructions.ReadByte(); err != nil {
+					return fmt.Errorf("invalid delta: truncated copy instruction")
 				}
 			}
+		}
 
-			start := binary.LittleEndian.Uint32(vals[0:4])
-			nbytes := uint32(binary.LittleEndian.Uint16(vals[4:6]))
-			if nbytes == 0 {
-				nbytes = 0x10000
-			}
+		start := uint64(binary.LittleEndian.Uint32(vals[0:4]))
+		nbytes := uint64(vals[4]) | uint64(vals[5])<<8 | uint64(vals[6])<<16
+		if nbytes == 0 {
+			nbytes = 0x10000
+		}
 
-			// log.Printf("COPY FROM BASE OBJECT: start=0x%x, #bytes=%d", start, nbytes)
-			destObject = append(destObject, baseObject.Content[start:start+nbytes]...)
+		if start+nbytes > uint64(len(r.base)) {
+			return fmt.Errorf("invalid delta: copy out of the base object (%d bytes at %d)", nbytes, start)
+		}
 
-		} else {
-			// add new data
-			nbytes := ch & 0x7f
+		r.pending = r.base[start : start+nbytes]
+		return nil
+	}
 
-			// log.Printf("APPEND NEW BYTES: #bytes=%d", nbytes)
+	// add new data
+	nbytes := ch & 0x7f
+	if nbytes == 0 {
+		return fmt.Errorf("invalid delta: unexpected opcode 0")
+	}
 
-			nBytesData := make([]byte, nbytes)
-			_, err := transformReader.Read(nBytesData)
-			if err != nil {
-				panic(err)
-			}
+	r.pending = make([]byte, nbytes)
+	if _, err := io.ReadFull(r.instructions, r.pending); err != nil {
+		return fmt.Errorf("invalid delta: truncated data")
+	}
+
+	return nil
+}
 
-			destObject = append(destObject, nBytesData...)
+func (r *deltaReader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
 		}
 	}
 
-	// fmt.Println(len(destObject), ObjSizeDest, baseObjSize)
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	r.read += int64(n)
+
+	if r.read > r.size {
+		return n, fmt.Errorf("invalid delta: result larger than %d bytes", r.size)
+	}
+
+	return n, nil
+}
+
+// ApplyDelta retrieves a offset_delta object, retrieves base object, patch base object content and returns the
+// offset_delta patched. Other objects are returned as is. Invalid deltas are *ErrCorruptPack.
+func (repo Repository) ApplyDelta(object Object) (Object, error) {
+	if object.Type != OBJECT_TYPE_OFS_DELTA && object.Type != OBJECT_TYPE_REF_DELTA {
+		return object, nil
+	}
+
+	baseObject, err := repo.openDeltaBase(object)
+	if err != nil {
+		return Object{}, err
+	}
+
+	corrupt := func(err error) error {
+		return &ErrCorruptPack{Pack: object.PackFile, Offset: object.Offset, Err: err}
+	}
+
+	// Transform the data
+	transformReader, err := newDeltaReader(baseObject.Content, object.Content)
+	if err != nil {
+		return Object{}, corrupt(err)
+	}
+
+	// the result is read until the end of the instructions, which fails if its size is not the header's one, so
+	// the buffer only grows as much as the delta really produces
+	destObject, err := io.ReadAll(transformReader)
+	if err != nil {
+		return Object{}, corrupt(err)
+	}
 
 	return Object{
 		Hash:            object.Hash,
@@ -321,12 +375,12 @@ func (repo Repository) ApplyDelta(object Object) Object {
 		Offset:          object.Offset,
 		Type:            baseObject.Type,
 		Content:         destObject,
-		ContentLen:      baseObject.ContentLen,
+		ContentLen:      len(destObject),
 		DeltaApplied:    true,
 		DeltaType:       object.Type,
 		DeltaContent:    object.Content,
 		DeltaContentLen: object.ContentLen,
-	}
+	}, nil
 }
 
 func (repo Repository) ReadObjRefDeltaObject() {
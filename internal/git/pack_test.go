@@ -0,0 +1,256 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"testing"
+)
+
+// testPackObject is an object of a pack written by writeTestPack. Deltas use the previous object as base.
+type testPackObject struct {
+	hash       ObjectID
+	objectType int    // 3 for blobs, 6 for offset deltas
+	size       int    // size given in the object header
+	content    []byte // deflated in the pack
+	offset     int64  // offset in the pack if set, leaving a hole in the sparse file; right after the previous object if 0
+}
+
+// appendVariantIntegerLE appends an integer as found in delta headers
+func appendVariantIntegerLE(data []byte, value uint64) []byte {
+	for value >= 0x80 {
+		data = append(data, byte(value&0x7f)|0x80)
+		value >>= 7
+	}
+	return append(data, byte(value))
+}
+
+// blobHash returns the hash of a blob of the given content
+func blobHash(content []byte) ObjectID {
+	return OBJECT_FORMAT_SHA1.Sum(append([]byte(fmt.Sprintf("blob %d\x00", len(content))), content...))
+}
+
+// writeTestPack writes a repository with a single pack holding the given objects, and returns it opened
+func writeTestPack(t *testing.T, objects []testPackObject) Repository {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeTestPackFiles(t, dir, objects)
+
+	repository, err := OpenRepository(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repository.Close() })
+
+	return repository
+}
+
+// writeTestPackFiles writes the pack and index files of writeTestPack in the repository at dir, as
+// "pack-test.{pack,idx}". Offsets past 2 GB are written in the index's large offsets table.
+func writeTestPackFiles(t *testing.T, dir string, objects []testPackObject) {
+	t.Helper()
+
+	packDir := path.Join(dir, ".git/objects/pack")
+	if err := os.MkdirAll(packDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	packFile, err := os.Create(path.Join(packDir, "pack-test.pack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer packFile.Close()
+
+	// writeAt writes data in the pack, and returns the offset following it
+	writeAt := func(data []byte, offset int64) int64 {
+		if _, err := packFile.WriteAt(data, offset); err != nil {
+			t.Fatal(err)
+		}
+		return offset + int64(len(data))
+	}
+
+	pack := []byte("PACK")
+	pack = binary.BigEndian.AppendUint32(pack, 2)
+	pack = binary.BigEndian.AppendUint32(pack, uint32(len(objects)))
+	end := writeAt(pack, 0)
+
+	offsets := make([]int64, 0, len(objects))
+	for n, object := range objects {
+		offsets = append(offsets, max(end, object.offset))
+
+		// type and size, 4 bits of size in the first byte then 7 in the next ones
+		size := uint64(object.size)
+		header := []byte{byte(object.objectType<<4) | byte(size&0x0f)}
+		for size >>= 4; size > 0; size >>= 7 {
+			header[len(header)-1] |= 0x80
+			header = append(header, byte(size&0x7f))
+		}
+		pack = header
+
+		if object.objectType == 6 {
+			distance := uint64(offsets[n] - offsets[n-1])
+			encoded := []byte{byte(distance & 0x7f)}
+			for distance >>= 7; distance > 0; distance >>= 7 {
+				distance--
+				encoded = append([]byte{byte(distance&0x7f) | 0x80}, encoded...)
+			}
+			pack = append(pack, encoded...)
+		}
+
+		var deflated bytes.Buffer
+		writer := zlib.NewWriter(&deflated)
+		writer.Write(object.content)
+		writer.Close()
+		pack = append(pack, deflated.Bytes()...)
+
+		end = writeAt(pack, offsets[n])
+	}
+	writeAt(make([]byte, SHA1_HASH_SIZE), end)
+
+	// version 2 index, whose entries are sorted by hash
+	order := make([]int, len(objects))
+	for n := range order {
+		order[n] = n
+	}
+	slices.SortFunc(order, func(a, b int) int { return objects[a].hash.Compare(objects[b].hash) })
+
+	idx := []byte{255, 116, 79, 99, 0, 0, 0, 2}
+	for first := range 256 {
+		count := 0
+		for _, object := range objects {
+			if int(object.hash.Bytes()[0]) <= first {
+				count++
+			}
+		}
+		idx = binary.BigEndian.AppendUint32(idx, uint32(count))
+	}
+	for _, n := range order {
+		idx = append(idx, objects[n].hash.Bytes()...)
+	}
+	idx = append(idx, make([]byte, 4*len(objects))...)
+	largeOffsets := make([]byte, 0)
+	for _, n := range order {
+		if offsets[n] < 1<<31 {
+			idx = binary.BigEndian.AppendUint32(idx, uint32(offsets[n]))
+			continue
+		}
+		idx = binary.BigEndian.AppendUint32(idx, 0x80000000|uint32(len(largeOffsets)/8))
+		largeOffsets = binary.BigEndian.AppendUint64(largeOffsets, uint64(offsets[n]))
+	}
+	idx = append(idx, largeOffsets...)
+	idx = append(idx, make([]byte, 2*SHA1_HASH_SIZE)...)
+
+	if err := os.WriteFile(path.Join(packDir, "pack-test.idx"), idx, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCorruptDeltas(t *testing.T) {
+	base := []byte("hello, world\n")
+	baseHash := blobHash(base)
+	deltaHash, _ := ParseObjectID("0123456789012345678901234567890123456789")
+
+	// deltaHeader returns the start of a delta of the base object, with the given result size
+	deltaHeader := func(size uint64) []byte {
+		return appendVariantIntegerLE(appendVariantIntegerLE(nil, uint64(len(base))), size)
+	}
+	// copy of the whole base object
+	copyBase := []byte{0x80 | 0x10, byte(len(base))}
+
+	tests := []struct {
+		name  string
+		size  int // size of the delta in the pack object header, the delta's length if 0
+		delta []byte
+	}{
+		{"oversized result", 0, append(deltaHeader(1<<63-1), copyBase...)},
+		{"oversized result, no instruction", 0, deltaHeader(1 << 62)},
+		{"larger result", 0, append(deltaHeader(uint64(len(base))+1), copyBase...)},
+		{"smaller result", 0, append(deltaHeader(uint64(len(base))-1), copyBase...)},
+		{"truncated header", 0, appendVariantIntegerLE(nil, uint64(len(base)))},
+		{"truncated size", 0, append(appendVariantIntegerLE(nil, uint64(len(base))), 0x80)},
+		{"invalid base size", 0, append(appendVariantIntegerLE(appendVariantIntegerLE(nil, 3), 13), copyBase...)},
+		{"copy out of the base", 0, append(deltaHeader(20), 0x80|0x10, 20)},
+		{"truncated insert", 0, append(deltaHeader(5), 5, 'a')},
+		{"oversized delta", 1 << 59, append(deltaHeader(uint64(len(base))), copyBase...)},
+		{"truncated delta", 100, append(deltaHeader(uint64(len(base))), copyBase...)},
+	}
+
+	for _, test := range tests {
+		size := test.size
+		if size == 0 {
+			size = len(test.delta)
+		}
+
+		repository := writeTestPack(t, []testPackObject{
+			{hash: baseHash, objectType: 3, size: len(base), content: base},
+			{hash: deltaHash, objectType: 6, size: size, content: test.delta},
+		})
+
+		var corrupt *ErrCorruptPack
+
+		object, err := repository.OpenObject(deltaHash)
+		if err == nil {
+			_, err = repository.ApplyDelta(object)
+		}
+		if !errors.As(err, &corrupt) {
+			t.Errorf("%s: ApplyDelta returned %v, expected a corrupt pack error", test.name, err)
+		}
+
+		_, reader, err := repository.OpenObjectReader(deltaHash)
+		if err == nil {
+			_, err = io.ReadAll(reader)
+			reader.Close()
+		}
+		if !errors.As(err, &corrupt) {
+			t.Errorf("%s: reading returned %v, expected a corrupt pack error", test.name, err)
+		}
+	}
+}
+
+func TestApplyDelta(t *testing.T) {
+	base := []byte("hello, world\n")
+	baseHash := blobHash(base)
+	deltaHash := blobHash([]byte("hello, git\n"))
+
+	// copy "hello, " from the base, then insert "git\n"
+	delta := appendVariantIntegerLE(appendVariantIntegerLE(nil, uint64(len(base))), 11)
+	delta = append(delta, 0x80|0x10, 7, 4, 'g', 'i', 't', '\n')
+
+	repository := writeTestPack(t, []testPackObject{
+		{hash: baseHash, objectType: 3, size: len(base), content: base},
+		{hash: deltaHash, objectType: 6, size: len(delta), content: delta},
+	})
+
+	object, err := repository.OpenObject(deltaHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if object, err = repository.ApplyDelta(object); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(object.Content) != "hello, git\n" || object.ContentLen != 11 || object.Type != OBJECT_TYPE_BLOB {
+		t.Errorf("ApplyDelta returned %s %q (%d bytes)", object.Type, object.Content, object.ContentLen)
+	}
+
+	header, reader, err := repository.OpenObjectReader(deltaHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "hello, git\n" || header.Size != 11 {
+		t.Errorf("OpenObjectReader returned %q (%d bytes)", content, header.Size)
+	}
+}
@@ -0,0 +1,240 @@
+package git
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// PackIndex is a pack's .idx file, either version 1 or 2. Its tables are kept as they are in the file: hashes are
+// sorted, so objects are found by binary search without reading the whole index.
+type PackIndex struct {
+	PackFile string
+	Fanout   [256]uint32 // number of objects whose hash' first byte is lower or equal to the entry's index
+
+	format       ObjectFormat
+	version      int
+	hashes       []byte // version 1: 4-byte offset & hash entries; version 2: hashes
+	offsets      []byte // version 2 only: offsets, or indexes in the large offsets table if their MSB is set
+	largeOffsets []byte // version 2 only: 8-byte offsets, for packs > 2 GB
+
+	revDirEntry string
+	revMu       sync.Mutex // guards the reverse index, shared by copies of the repository
+	revIndex    []uint32   // .idx positions sorted by pack offset, set on first use
+	revOffsets  []int64    // offsets, in revIndex order
+
+	idx  *mappedFile // tables above are slices of it
+	pack *mappedFile // objects are read directly from it
+}
+
+// readFanout reads a 256 entries fanout table, checking it is sorted
+func readFanout(data []byte) ([256]uint32, error) {
+	var fanout [256]uint32
+
+	for n := range 256 {
+		fanout[n] = binary.BigEndian.Uint32(data[4*n:])
+		if n > 0 && fanout[n] < fanout[n-1] {
+			return fanout, fmt.Errorf("invalid fanout table")
+		}
+	}
+
+	return fanout, nil
+}
+
+// searchFanout searches a hash in a sorted table, restricted by the fanout table to the hashes sharing its first
+// byte. It returns the hash' position, or false if it is not in the table.
+func searchFanout(fanout *[256]uint32, hash ObjectID, hashAt func(n int) []byte) (int, bool) {
+	first := hash.Bytes()[0]
+
+	low := 0
+	if first > 0 {
+		low = int(fanout[first-1])
+	}
+	high := int(fanout[first])
+
+	n := sort.Search(high-low, func(i int) bool {
+		return bytes.Compare(hashAt(low+i), hash.Bytes()) >= 0
+	}) + low
+
+	return n, n < high && bytes.Equal(hashAt(n), hash.Bytes())
+}
+
+// searchPrefix returns the hashes of a sorted table of count hashes starting with the given hex prefix
+func searchPrefix(count int, prefix string, hashAt func(n int) ObjectID) []ObjectID {
+	hashes := make([]ObjectID, 0)
+
+	// hex hashes sort as binary ones do
+	n := sort.Search(count, func(i int) bool {
+		return hashAt(i).String() >= prefix
+	})
+	for ; n < count && hashAt(n).HasPrefix(prefix); n++ {
+		hashes = append(hashes, hashAt(n))
+	}
+
+	return hashes
+}
+
+// OpenPackIndex maps a pack's .idx file and its .pack file, and checks the index's tables' sizes. Objects are only
+// read as they are looked up. The files stay mapped until the index is closed.
+func (repo Repository) OpenPackIndex(idxDirEntry, packDirEntry string) (*PackIndex, error) {
+	index := &PackIndex{
+		PackFile:    packDirEntry,
+		format:      repo.ObjectFormat,
+		revDirEntry: strings.TrimSuffix(idxDirEntry, ".idx") + ".rev",
+	}
+
+	if err := index.open(repo, idxDirEntry); err != nil {
+		index.Close()
+		return nil, err
+	}
+
+	return index, nil
+}
+
+// open maps the index and pack files, and reads the index's tables
+func (index *PackIndex) open(repo Repository, idxDirEntry string) error {
+	var err error
+
+	if index.pack, err = openMappedFile(path.Join(repo.GetPackDir(), index.PackFile)); err != nil {
+		return err
+	}
+
+	header := index.pack.Data
+	if len(header) < PACK_HEADER_SIZE || !bytes.Equal(header[:4], []byte("PACK")) {
+		return &ErrCorruptPack{Pack: index.PackFile, Err: fmt.Errorf("invalid header")}
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 2 && version != 3 {
+		return fmt.Errorf("%w for pack %s: %d", ErrUnsupportedVersion, index.PackFile, version)
+	}
+
+	if index.idx, err = openMappedFile(path.Join(repo.GetPackDir(), idxDirEntry)); err != nil {
+		return err
+	}
+
+	data := index.idx.Data
+	hashSize := index.format.Size()
+
+	// Version 1 files have no header and directly start with the fanout table
+	index.version = 1
+	if bytes.HasPrefix(data, []byte{255, 116, 79, 99}) {
+		if len(data) < 8 {
+			return &ErrCorruptPack{Pack: index.PackFile, Err: fmt.Errorf("truncated pack index %s", idxDirEntry)}
+		}
+		if version := binary.BigEndian.Uint32(data[4:8]); version != 2 {
+			return fmt.Errorf("%w for pack index %s: %d", ErrUnsupportedVersion, idxDirEntry, version)
+		}
+		index.version = 2
+		data = data[8:]
+	}
+
+	// the index ends with the pack's checksum and its own
+	if len(data) < 256*4+2*hashSize {
+		return &ErrCorruptPack{Pack: index.PackFile, Err: fmt.Errorf("truncated pack index %s", idxDirEntry)}
+	}
+	if index.Fanout, err = readFanout(data); err != nil {
+		return &ErrCorruptPack{Pack: index.PackFile, Err: fmt.Errorf("%w in pack index %s", err, idxDirEntry)}
+	}
+
+	count := int(index.Fanout[255])
+	tables := data[256*4 : len(data)-2*hashSize]
+
+	if index.version == 1 {
+		if len(tables) != count*(4+hashSize) {
+			return &ErrCorruptPack{Pack: index.PackFile, Err: fmt.Errorf("invalid size for pack index %s", idxDirEntry)}
+		}
+		index.hashes = tables
+		return nil
+	}
+
+	// version 2 has the hashes, then CRCs, which are not used, offsets, and large offsets
+	if len(tables) < count*(hashSize+8) || (len(tables)-count*(hashSize+8))%8 != 0 {
+		return &ErrCorruptPack{Pack: index.PackFile, Err: fmt.Errorf("invalid size for pack index %s", idxDirEntry)}
+	}
+	index.hashes = tables[:count*hashSize]
+	index.offsets = tables[count*(hashSize+4) : count*(hashSize+8)]
+	index.largeOffsets = tables[count*(hashSize+8):]
+
+	return nil
+}
+
+// Close unmaps the index and pack files. Objects of the pack can not be read anymore.
+func (index *PackIndex) Close() error {
+	var errs []error
+
+	for _, file := range []*mappedFile{index.idx, index.pack} {
+		if file != nil {
+			errs = append(errs, file.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Len returns the number of objects in the pack
+func (index *PackIndex) Len() int {
+	return int(index.Fanout[255])
+}
+
+func (index *PackIndex) hashBytes(n int) []byte {
+	hashSize := index.format.Size()
+
+	if index.version == 1 {
+		return index.hashes[n*(4+hashSize)+4 : (n+1)*(4+hashSize)]
+	}
+	return index.hashes[n*hashSize : (n+1)*hashSize]
+}
+
+// HashAt returns the hash of the object at a position of the index
+func (index *PackIndex) HashAt(n int) ObjectID {
+	hash, _ := NewObjectID(index.format, index.hashBytes(n))
+	return hash
+}
+
+// OffsetAt returns the offset in the pack of the object at a position of the index
+func (index *PackIndex) OffsetAt(n int) (int64, error) {
+	if index.version == 1 {
+		return int64(binary.BigEndian.Uint32(index.hashes[n*(4+index.format.Size()):])), nil
+	}
+
+	offset := binary.BigEndian.Uint32(index.offsets[n*4:])
+	if offset&0x80000000 == 0 {
+		return int64(offset), nil
+	}
+
+	largeOffsetIdx := int(offset & 0x7fffffff)
+	if len(index.largeOffsets) < (largeOffsetIdx+1)*8 {
+		return 0, &ErrCorruptPack{Pack: index.PackFile, Err: fmt.Errorf("invalid large offset index: %d", largeOffsetIdx)}
+	}
+
+	return int64(binary.BigEndian.Uint64(index.largeOffsets[largeOffsetIdx*8:])), nil
+}
+
+func (index *PackIndex) object(n int) (Object, error) {
+	offset, err := index.OffsetAt(n)
+	if err != nil {
+		return Object{}, err
+	}
+
+	return Object{
+		Hash:         index.HashAt(n),
+		LocationType: LOCATION_PACK,
+		PackFile:     index.PackFile,
+		Offset:       offset,
+	}, nil
+}
+
+// Lookup searches for an object by its hash, using the fanout table to restrict the binary search
+func (index *PackIndex) Lookup(hash ObjectID) (Object, bool, error) {
+	n, ok := searchFanout(&index.Fanout, hash, index.hashBytes)
+	if !ok {
+		return Object{}, false, nil
+	}
+
+	object, err := index.object(n)
+	return object, err == nil, err
+}
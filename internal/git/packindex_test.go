@@ -0,0 +1,160 @@
+package git
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCorruptPackIndex(t *testing.T) {
+	content := []byte("hello, world\n")
+	hash := blobHash(content)
+
+	tests := []struct {
+		name    string
+		corrupt func(pack, idx []byte) ([]byte, []byte)
+	}{
+		{"invalid pack header", func(pack, idx []byte) ([]byte, []byte) {
+			return append([]byte("KCAP"), pack[4:]...), idx
+		}},
+		{"truncated header", func(pack, idx []byte) ([]byte, []byte) {
+			return pack, idx[:6]
+		}},
+		{"truncated fanout", func(pack, idx []byte) ([]byte, []byte) {
+			return pack, idx[:8+100]
+		}},
+		{"unsorted fanout", func(pack, idx []byte) ([]byte, []byte) {
+			binary.BigEndian.PutUint32(idx[8:], 0xffffffff)
+			return pack, idx
+		}},
+		{"invalid size", func(pack, idx []byte) ([]byte, []byte) {
+			return pack, append(idx, 0, 0, 0, 0)
+		}},
+		{"invalid large offset", func(pack, idx []byte) ([]byte, []byte) {
+			// the single offset, after the header, fanout, hash and CRC
+			binary.BigEndian.PutUint32(idx[8+256*4+SHA1_HASH_SIZE+4:], 0x80000005)
+			return pack, idx
+		}},
+	}
+
+	for _, test := range tests {
+		dir := t.TempDir()
+		writeTestPackFiles(t, dir, []testPackObject{{hash: hash, objectType: 3, size: len(content), content: content}})
+
+		packPath := path.Join(dir, ".git/objects/pack/pack-test.pack")
+		idxPath := path.Join(dir, ".git/objects/pack/pack-test.idx")
+
+		pack, err := os.ReadFile(packPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idx, err := os.ReadFile(idxPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pack, idx = test.corrupt(pack, idx)
+		if err := os.WriteFile(packPath, pack, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(idxPath, idx, 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		repository, err := OpenRepository(dir)
+		if err == nil {
+			_, err = repository.OpenObject(hash)
+			repository.Close()
+		}
+
+		var corrupt *ErrCorruptPack
+		if !errors.As(err, &corrupt) {
+			t.Errorf("%s: returned %v, expected a corrupt pack error", test.name, err)
+		}
+	}
+}
+
+func TestLargeOffsets(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("pack files are only memory-mapped on linux, and read in memory otherwise")
+	}
+
+	base := []byte("hello, world\n")
+	delta := appendVariantIntegerLE(appendVariantIntegerLE(nil, uint64(len(base))), 11)
+	delta = append(delta, 0x80|0x10, 7, 4, 'g', 'i', 't', '\n')
+	large := []byte("hello, large offsets\n")
+	largeDelta := appendVariantIntegerLE(appendVariantIntegerLE(nil, uint64(len(large))), 14)
+	largeDelta = append(largeDelta, 0x80|0x10, 7, 7, 'o', 'f', 'f', 's', 'e', 't', '\n')
+
+	// the pack file is sparse: objects past 2 GB use the index's large offsets table, and ones past 4 GB don't fit
+	// in 32 bits. Each delta's base is the previous object.
+	objects := []testPackObject{
+		{hash: blobHash(base), objectType: 3, size: len(base), content: base},
+		{hash: blobHash([]byte("hello, git\n")), objectType: 6, size: len(delta), content: delta, offset: 3 << 30},
+		{hash: blobHash(large), objectType: 3, size: len(large), content: large, offset: 5 << 30},
+		{hash: blobHash([]byte("hello, offset\n")), objectType: 6, size: len(largeDelta), content: largeDelta},
+	}
+	expected := []string{"hello, world\n", "hello, git\n", "hello, large offsets\n", "hello, offset\n"}
+
+	repository := writeTestPack(t, objects)
+	if index := repository.Packs["pack-test.pack"]; len(index.largeOffsets) != 3*8 {
+		t.Fatalf("the index has %d bytes of large offsets, expected 3 entries", len(index.largeOffsets))
+	}
+
+	for n, object := range objects {
+		opened, err := repository.OpenObject(object.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if object.offset != 0 && opened.Offset != object.offset {
+			t.Errorf("object %d is at offset %d, expected %d", n, opened.Offset, object.offset)
+		}
+
+		if opened, err = repository.ApplyDelta(opened); err != nil {
+			t.Fatal(err)
+		}
+		if string(opened.Content) != expected[n] {
+			t.Errorf("object %d is %q, expected %q", n, opened.Content, expected[n])
+		}
+
+		_, reader, err := repository.OpenObjectReader(object.hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil || string(content) != expected[n] {
+			t.Errorf("reading object %d returned %q, %v, expected %q", n, content, err, expected[n])
+		}
+	}
+}
+
+func TestPackIndexVersion1(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.writeHistory()
+	repo.git(nil, "repack", "-adq")
+
+	packs, err := filepath.Glob(path.Join(repo.dir, ".git/objects/pack/*.pack"))
+	if err != nil || len(packs) != 1 {
+		t.Fatalf("expected a single pack, found %v (%v)", packs, err)
+	}
+	idxPath := strings.TrimSuffix(packs[0], ".pack") + ".idx"
+
+	if err := os.Remove(idxPath); err != nil {
+		t.Fatal(err)
+	}
+	repo.git(nil, "index-pack", "--index-version=1", "-o", idxPath, packs[0])
+
+	repository := repo.open(false)
+	if index := repository.Packs[path.Base(packs[0])]; index.version != 1 {
+		t.Fatalf("the pack index is version %d, expected 1", index.version)
+	}
+
+	repo.checkObjects(repository)
+}
@@ -0,0 +1,492 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	DEFAULT_CONTEXT_LINES = 3
+
+	// maximum length of the function name shown in hunk headers
+	HUNK_FUNCTION_MAX_LEN = 80
+
+	// width of --stat output, as git uses when not writing to a terminal
+	DEFAULT_STAT_WIDTH = 80
+)
+
+type PatchOptions struct {
+	Algorithm    DiffAlgorithm
+	ContextLines int // lines of context around changes, none if 0
+}
+
+// HunkLine is a line of a hunk: Type is ' ' for context, '-' for removed and '+' for added lines. Text keeps the
+// line's newline, if it has one.
+type HunkLine struct {
+	Type byte
+	Text string
+}
+
+// Hunk is a group of changes with their context lines. Starts are 1-based line numbers, as shown in patches.
+type Hunk struct {
+	OldStart int
+	OldCount int
+	NewStart int
+	NewCount int
+	Function string // nearest line before the hunk looking like a function header
+	Lines    []HunkLine
+}
+
+// FilePatch is the line-level diff of a changed file
+type FilePatch struct {
+	Change  TreeChange
+	Binary  bool
+	OldSize int
+	NewSize int
+	Added   int // number of added lines, 0 for binary files
+	Deleted int // number of deleted lines, 0 for binary files
+	Hunks   []Hunk
+}
+
+// readChangeContent returns the content of one side of a change: blob content, or the commit of a submodule as git
+// shows it. The null hash has no content.
+func (repo Repository) readChangeContent(hash ObjectID, mode int) ([]byte, error) {
+	if hash.IsZero() {
+		return []byte{}, nil
+	}
+
+	if mode == OBJ_TYPE_SUBMODULE {
+		return []byte(fmt.Sprintf("Subproject commit %s\n", hash)), nil
+	}
+
+	object, err := repo.openResolvedObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	if object.Type != OBJECT_TYPE_BLOB {
+		return nil, fmt.Errorf("object %s is a %s, not a blob", hash, object.Type)
+	}
+
+	return object.Content, nil
+}
+
+// NewFilePatch diffs the old and new contents of a changed file. options can be nil for the defaults.
+func (repo Repository) NewFilePatch(change TreeChange, options *PatchOptions) (*FilePatch, error) {
+	if options == nil {
+		options = &PatchOptions{ContextLines: DEFAULT_CONTEXT_LINES}
+	}
+
+	oldContent, err := repo.readChangeContent(change.OldHash, change.OldMode)
+	if err != nil {
+		return nil, err
+	}
+
+	newContent, err := repo.readChangeContent(change.NewHash, change.NewMode)
+	if err != nil {
+		return nil, err
+	}
+
+	patch := &FilePatch{
+		Change:  change,
+		Binary:  IsBinary(oldContent) || IsBinary(newContent),
+		OldSize: len(oldContent),
+		NewSize: len(newContent),
+		Hunks:   make([]Hunk, 0),
+	}
+
+	if patch.Binary || change.OldHash == change.NewHash {
+		return patch, nil
+	}
+
+	oldLines := SplitLines(oldContent)
+	newLines := SplitLines(newContent)
+	changes := DiffLines(oldLines, newLines, options.Algorithm)
+
+	for _, lineChange := range changes {
+		patch.Deleted += lineChange.OldCount
+		patch.Added += lineChange.NewCount
+	}
+
+	patch.Hunks = buildHunks(oldLines, newLines, changes, options.ContextLines)
+
+	return patch, nil
+}
+
+// buildHunks groups changes closer than twice the context into hunks, as git does
+func buildHunks(oldLines, newLines []string, changes []LineChange, context int) []Hunk {
+	hunks := make([]Hunk, 0)
+
+	for first := 0; first < len(changes); {
+		last := first
+		for last+1 < len(changes) &&
+			changes[last+1].OldStart-(changes[last].OldStart+changes[last].OldCount) <= 2*context {
+			last++
+		}
+
+		start1 := max(changes[first].OldStart-context, 0)
+		start2 := max(changes[first].NewStart-context, 0)
+		end1 := min(changes[last].OldStart+changes[last].OldCount+context, len(oldLines))
+		end2 := min(changes[last].NewStart+changes[last].NewCount+context, len(newLines))
+
+		hunk := Hunk{
+			OldStart: start1 + 1,
+			OldCount: end1 - start1,
+			NewStart: start2 + 1,
+			NewCount: end2 - start2,
+			Function: hunkFunction(oldLines, start1-1),
+		}
+
+		n1, n2 := start1, start2
+		for _, change := range changes[first : last+1] {
+			for ; n2 < change.NewStart; n1, n2 = n1+1, n2+1 {
+				hunk.Lines = append(hunk.Lines, HunkLine{Type: ' ', Text: newLines[n2]})
+			}
+			for ; n1 < change.OldStart+change.OldCount; n1++ {
+				hunk.Lines = append(hunk.Lines, HunkLine{Type: '-', Text: oldLines[n1]})
+			}
+			for ; n2 < change.NewStart+change.NewCount; n2++ {
+				hunk.Lines = append(hunk.Lines, HunkLine{Type: '+', Text: newLines[n2]})
+			}
+		}
+		for ; n2 < end2; n2++ {
+			hunk.Lines = append(hunk.Lines, HunkLine{Type: ' ', Text: newLines[n2]})
+		}
+
+		hunks = append(hunks, hunk)
+		first = last + 1
+	}
+
+	return hunks
+}
+
+// hunkFunction returns the nearest line, from the given one backwards, starting like an identifier, as git does by
+// default to find function headers
+func hunkFunction(lines []string, from int) string {
+	for n := min(from, len(lines)-1); n >= 0; n-- {
+		line := lines[n]
+		if line == "" {
+			continue
+		}
+
+		if c := line[0]; (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_' || c == '$' {
+			if len(line) > HUNK_FUNCTION_MAX_LEN {
+				line = line[:HUNK_FUNCTION_MAX_LEN]
+			}
+			return strings.TrimRight(line, " \t\n\v\f\r")
+		}
+	}
+
+	return ""
+}
+
+// formatRange formats a hunk range as in hunk headers: the count is omitted if 1, and an empty range starts at the
+// line before it
+func formatRange(start, count int) string {
+	if count == 0 {
+		start--
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+func (hunk Hunk) String() string {
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "@@ -%s +%s @@", formatRange(hunk.OldStart, hunk.OldCount), formatRange(hunk.NewStart, hunk.NewCount))
+	if hunk.Function != "" {
+		out.WriteString(" " + hunk.Function)
+	}
+	out.WriteString("\n")
+
+	for _, line := range hunk.Lines {
+		out.WriteByte(line.Type)
+		out.WriteString(line.Text)
+		if !strings.HasSuffix(line.Text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+
+	return out.String()
+}
+
+// WritePatch writes a file patch in git's unified format. A type change is shown as a deletion followed by an
+// addition.
+func (repo Repository) WritePatch(w io.Writer, patch *FilePatch) error {
+	change := patch.Change
+
+	// parts are whole deletions & additions, which don't depend on the diff options
+	if change.Type == CHANGE_TYPE_CHANGED {
+		parts := []TreeChange{
+			{Type: CHANGE_DELETED, OldPath: change.OldPath, OldHash: change.OldHash, OldMode: change.OldMode},
+			{Type: CHANGE_ADDED, NewPath: change.NewPath, NewHash: change.NewHash, NewMode: change.NewMode},
+		}
+
+		for _, part := range parts {
+			partPatch, err := repo.NewFilePatch(part, nil)
+			if err != nil {
+				return err
+			}
+			if err := repo.WritePatch(w, partPatch); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	oldPath, newPath := change.OldPath, change.NewPath
+	oldLabel, newLabel := QuotePath("a/"+oldPath), QuotePath("b/"+newPath)
+	switch change.Type {
+	case CHANGE_ADDED:
+		oldPath, oldLabel = newPath, "/dev/null"
+	case CHANGE_DELETED:
+		newPath, newLabel = oldPath, "/dev/null"
+	}
+
+	header := fmt.Sprintf("diff --git %s %s\n", QuotePath("a/"+oldPath), QuotePath("b/"+newPath))
+
+	switch {
+	case change.Type == CHANGE_ADDED:
+		header += fmt.Sprintf("new file mode %06d\n", change.NewMode)
+	case change.Type == CHANGE_DELETED:
+		header += fmt.Sprintf("deleted file mode %06d\n", change.OldMode)
+	case change.OldMode != change.NewMode:
+		header += fmt.Sprintf("old mode %06d\nnew mode %06d\n", change.OldMode, change.NewMode)
+	}
+
+	switch change.Type {
+	case CHANGE_RENAMED:
+		header += fmt.Sprintf("similarity index %d%%\nrename from %s\nrename to %s\n", change.Similarity, QuotePath(change.OldPath), QuotePath(change.NewPath))
+	case CHANGE_COPIED:
+		header += fmt.Sprintf("similarity index %d%%\ncopy from %s\ncopy to %s\n", change.Similarity, QuotePath(change.OldPath), QuotePath(change.NewPath))
+	}
+
+	if change.OldHash != change.NewHash {
+		header += fmt.Sprintf("index %s..%s", repo.AbbreviateHash(change.OldHash), repo.AbbreviateHash(change.NewHash))
+		if change.OldMode == change.NewMode {
+			header += fmt.Sprintf(" %06d", change.OldMode)
+		}
+		header += "\n"
+	}
+
+	if patch.Binary && change.OldHash != change.NewHash {
+		header += fmt.Sprintf("Binary files %s and %s differ\n", oldLabel, newLabel)
+	} else if len(patch.Hunks) > 0 {
+		// as git does, names with a space end with a tab, so patch tools can tell where they end
+		if oldLabel != "/dev/null" && strings.Contains(oldPath, " ") {
+			oldLabel += "\t"
+		}
+		if newLabel != "/dev/null" && strings.Contains(newPath, " ") {
+			newLabel += "\t"
+		}
+		header += fmt.Sprintf("--- %s\n+++ %s\n", oldLabel, newLabel)
+	}
+
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+
+	for _, hunk := range patch.Hunks {
+		if _, err := io.WriteString(w, hunk.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// statName returns the name of a changed file as shown by --stat & --numstat: renames and copies are shown as
+// "common/{old => new}/path"
+func statName(change TreeChange) string {
+	if change.Type != CHANGE_RENAMED && change.Type != CHANGE_COPIED {
+		return QuotePath(change.Path())
+	}
+
+	a, b := QuotePath(change.OldPath), QuotePath(change.NewPath)
+
+	prefix := 0
+	for n := 0; n < len(a) && n < len(b) && a[n] == b[n]; n++ {
+		if a[n] == '/' {
+			prefix = n + 1
+		}
+	}
+
+	// if there is a common prefix, it ends with a slash which may also start the common suffix
+	suffix := 0
+	adjust := 0
+	if prefix > 0 {
+		adjust = 1
+	}
+	for i, j := len(a), len(b); i >= prefix-adjust && j >= prefix-adjust; i, j = i-1, j-1 {
+		ca, cb := byte(0), byte(0)
+		if i < len(a) {
+			ca = a[i]
+		}
+		if j < len(b) {
+			cb = b[j]
+		}
+		if ca != cb {
+			break
+		}
+		if ca == '/' {
+			suffix = len(a) - i
+		}
+	}
+
+	aMid := max(len(a)-prefix-suffix, 0)
+	bMid := max(len(b)-prefix-suffix, 0)
+
+	if prefix+suffix == 0 {
+		return fmt.Sprintf("%s => %s", a, b)
+	}
+	return fmt.Sprintf("%s{%s => %s}%s", a[:prefix], a[prefix:prefix+aMid], b[prefix:prefix+bMid], a[len(a)-suffix:])
+}
+
+// WriteNumStat writes the number of added and deleted lines of each file, as git diff --numstat does
+func WriteNumStat(w io.Writer, patches []*FilePatch) error {
+	for _, patch := range patches {
+		var err error
+		if patch.Binary {
+			_, err = fmt.Fprintf(w, "-\t-\t%s\n", statName(patch.Change))
+		} else {
+			_, err = fmt.Fprintf(w, "%d\t%d\t%s\n", patch.Added, patch.Deleted, statName(patch.Change))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scaleLinear scales a number of changes to a graph width, keeping at least one column for a non-zero value
+func scaleLinear(value, width, maxChange int) int {
+	if value == 0 {
+		return 0
+	}
+	return 1 + value*(width-1)/maxChange
+}
+
+// WriteDiffStat writes a histogram of changes per file, then a summary, as git diff --stat does. width is the
+// maximum width of lines, DEFAULT_STAT_WIDTH if 0.
+func WriteDiffStat(w io.Writer, patches []*FilePatch, width int) error {
+	if len(patches) == 0 {
+		return nil
+	}
+	if width == 0 {
+		width = DEFAULT_STAT_WIDTH
+	}
+
+	maxLen, maxChange, numberWidth, binWidth := 0, 0, 0, 0
+	for _, patch := range patches {
+		maxLen = max(maxLen, utf8.RuneCountInString(statName(patch.Change)))
+
+		if patch.Binary {
+			// "Bin XXX -> YYY bytes"
+			binWidth = max(binWidth, 14+len(fmt.Sprint(patch.OldSize))+len(fmt.Sprint(patch.NewSize)))
+			numberWidth = 3
+			continue
+		}
+
+		maxChange = max(maxChange, patch.Added+patch.Deleted)
+	}
+
+	numberWidth = max(numberWidth, len(fmt.Sprint(maxChange)))
+	width = max(width, 16+6+numberWidth)
+
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+	nameWidth := maxLen
+
+	// the graph gets 3/8 of the width at most if both don't fit
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = max(width*3/8-numberWidth-6, 6)
+		}
+
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+
+	totalAdded, totalDeleted := 0, 0
+
+	for _, patch := range patches {
+		name := statName(patch.Change)
+		prefix := ""
+		length := nameWidth
+
+		// names too long are shown as ".../end/of/path"
+		if runes := []rune(name); len(runes) > nameWidth {
+			prefix = "..."
+			length = max(length-3, 0)
+			name = string(runes[len(runes)-length:])
+			if slash := strings.IndexByte(name, '/'); slash != -1 {
+				name = name[slash:]
+			}
+		}
+		padding := strings.Repeat(" ", max(length-utf8.RuneCountInString(name), 0))
+
+		var line string
+		if patch.Binary {
+			line = fmt.Sprintf(" %s%s%s | %*s", prefix, name, padding, numberWidth, "Bin")
+			if patch.OldSize != 0 || patch.NewSize != 0 {
+				line += fmt.Sprintf(" %d -> %d bytes", patch.OldSize, patch.NewSize)
+			}
+		} else {
+			added, deleted := patch.Added, patch.Deleted
+			totalAdded += added
+			totalDeleted += deleted
+
+			if graphWidth <= maxChange {
+				total := scaleLinear(added+deleted, graphWidth, maxChange)
+				if total < 2 && added > 0 && deleted > 0 {
+					total = 2
+				}
+				if added < deleted {
+					added = scaleLinear(added, graphWidth, maxChange)
+					deleted = total - added
+				} else {
+					deleted = scaleLinear(deleted, graphWidth, maxChange)
+					added = total - deleted
+				}
+			}
+
+			line = fmt.Sprintf(" %s%s%s | %*d", prefix, name, padding, numberWidth, patch.Added+patch.Deleted)
+			if patch.Added+patch.Deleted > 0 {
+				line += " "
+			}
+			line += strings.Repeat("+", added) + strings.Repeat("-", deleted)
+		}
+
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	summary := fmt.Sprintf(" %d file%s changed", len(patches), plural(len(patches)))
+	if totalAdded > 0 || totalDeleted == 0 {
+		summary += fmt.Sprintf(", %d insertion%s(+)", totalAdded, plural(totalAdded))
+	}
+	if totalDeleted > 0 || totalAdded == 0 {
+		summary += fmt.Sprintf(", %d deletion%s(-)", totalDeleted, plural(totalDeleted))
+	}
+
+	_, err := fmt.Fprintln(w, summary)
+	return err
+}
+
+func plural(count int) string {
+	if count == 1 {
+		return ""
+	}
+	return "s"
+}
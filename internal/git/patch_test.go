@@ -0,0 +1,160 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"testing"
+)
+
+// randomLines returns count lines looking like code, from a small vocabulary so that lines repeat
+func randomLines(random *rand.Rand, count int) []string {
+	lines := make([]string, 0, count)
+	for range count {
+		switch random.IntN(6) {
+		case 0:
+			lines = append(lines, fmt.Sprintf("func f%d() {\n", random.IntN(10)))
+		case 1:
+			lines = append(lines, fmt.Sprintf("\treturn %d\n", random.IntN(5)))
+		case 2:
+			lines = append(lines, "}\n")
+		case 3:
+			lines = append(lines, "\n")
+		case 4:
+			lines = append(lines, fmt.Sprintf("// comment %d\n", random.IntN(20)))
+		default:
+			lines = append(lines, fmt.Sprintf("\tx := %d\n", random.IntN(50)))
+		}
+	}
+	return lines
+}
+
+// editLines returns lines with a few random deletions, insertions, replacements and moves of blocks
+func editLines(random *rand.Rand, lines []string) []string {
+	edited := append([]string{}, lines...)
+
+	for range 1 + random.IntN(6) {
+		start := random.IntN(len(edited) + 1)
+		end := min(len(edited), start+random.IntN(8))
+
+		switch random.IntN(4) {
+		case 0:
+			edited = append(edited[:start], edited[end:]...)
+		case 1:
+			edited = append(edited[:start], append(randomLines(random, 1+random.IntN(8)), edited[start:]...)...)
+		case 2:
+			edited = append(edited[:start], append(randomLines(random, 1+random.IntN(8)), edited[end:]...)...)
+		default:
+			block := append([]string{}, edited[start:end]...)
+			edited = append(edited[:start], edited[end:]...)
+			at := random.IntN(len(edited) + 1)
+			edited = append(edited[:at], append(block, edited[at:]...)...)
+		}
+	}
+
+	return edited
+}
+
+// randomTrees returns the files of two trees, the second one having changed, renamed, added and deleted files
+func randomTrees(seed uint64) (map[string]string, map[string]string) {
+	random := rand.New(rand.NewPCG(seed, seed))
+
+	oldFiles, newFiles := make(map[string]string), make(map[string]string)
+	for n := range 3 {
+		lines := randomLines(random, 20+random.IntN(100))
+		name := fmt.Sprintf("src/file%d.go", n)
+		oldFiles[name] = strings.Join(lines, "")
+		newFiles[name] = strings.Join(editLines(random, lines), "")
+	}
+
+	renamed := randomLines(random, 40)
+	oldFiles["doc/old name.txt"] = strings.Join(renamed, "")
+	newFiles["doc/new name.txt"] = strings.Join(editLines(random, renamed), "")
+
+	noNewline := randomLines(random, 10)
+	oldFiles["no-newline"] = strings.TrimSuffix(strings.Join(noNewline, ""), "\n")
+	newFiles["no-newline"] = strings.TrimSuffix(strings.Join(editLines(random, noNewline), ""), "\n")
+
+	oldFiles["binary.bin"] = "\x00\x01" + strings.Join(randomLines(random, 5), "")
+	newFiles["binary.bin"] = "\x00\x02" + strings.Join(randomLines(random, 8), "")
+
+	oldFiles["a/rather/long/path/to/a/file/whose/name/does/not/fit/in/the/stat/output.txt"] = "deleted\n"
+	newFiles["added.txt"] = strings.Join(randomLines(random, 300), "")
+
+	return oldFiles, newFiles
+}
+
+func TestPatches(t *testing.T) {
+	algorithms := []struct {
+		algorithm DiffAlgorithm
+		args      []string // git diff options
+	}{
+		{DIFF_ALGORITHM_MYERS, nil},
+		{DIFF_ALGORITHM_HISTOGRAM, []string{"--histogram"}},
+	}
+
+	repo := newTestRepo(t)
+	trees := make([][2]string, 0)
+	for seed := range uint64(20) {
+		oldFiles, newFiles := randomTrees(seed)
+		trees = append(trees, [2]string{repo.tree(oldFiles), repo.tree(newFiles)})
+	}
+	repository := repo.open(false)
+
+	for seed, tree := range trees {
+		oldTree, _ := ParseObjectID(tree[0])
+		newTree, _ := ParseObjectID(tree[1])
+
+		changes, err := repository.DiffTrees(oldTree, newTree, &DiffOptions{DetectRenames: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, algorithm := range algorithms {
+			patches := make([]*FilePatch, 0, len(changes))
+			for _, change := range changes {
+				patch, err := repository.NewFilePatch(change, &PatchOptions{
+					Algorithm:    algorithm.algorithm,
+					ContextLines: DEFAULT_CONTEXT_LINES,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				patches = append(patches, patch)
+			}
+
+			var got bytes.Buffer
+			for _, patch := range patches {
+				if err := repository.WritePatch(&got, patch); err != nil {
+					t.Fatal(err)
+				}
+			}
+			args := append([]string{"diff"}, algorithm.args...)
+			if expected := repo.git(nil, append(args, tree[0], tree[1])...); strings.TrimSpace(got.String()) != expected {
+				t.Errorf("seed %d: diff %s:\n%s\nexpected:\n%s", seed, strings.Join(algorithm.args, " "), got.String(),
+					expected)
+			}
+
+			got.Reset()
+			if err := WriteDiffStat(&got, patches, 0); err != nil {
+				t.Fatal(err)
+			}
+			args = append([]string{"diff", "--stat"}, algorithm.args...)
+			if expected := repo.git(nil, append(args, tree[0], tree[1])...); strings.TrimSpace(got.String()) != expected {
+				t.Errorf("seed %d: diff --stat %s:\n%s\nexpected:\n%s", seed, strings.Join(algorithm.args, " "),
+					got.String(), expected)
+			}
+
+			got.Reset()
+			if err := WriteNumStat(&got, patches); err != nil {
+				t.Fatal(err)
+			}
+			args = append([]string{"diff", "--numstat"}, algorithm.args...)
+			if expected := repo.git(nil, append(args, tree[0], tree[1])...); strings.TrimSpace(got.String()) != expected {
+				t.Errorf("seed %d: diff --numstat %s:\n%s\nexpected:\n%s", seed, strings.Join(algorithm.args, " "),
+					got.String(), expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maximum number of symbolic references followed while resolving a reference, like git does
+	SYMREF_MAX_DEPTH = 5
+)
+
+var (
+	// ErrRefNotFound is returned when a reference exists neither as a loose file nor in packed-refs
+	ErrRefNotFound = errors.New("reference not found")
+	// ErrSymbolicRefLoop is returned when following symbolic references loops or goes too deep
+	ErrSymbolicRefLoop = errors.New("symbolic reference loop")
+	// ErrUnbornBranch is returned when HEAD points to a branch which does not exist yet, as in a new repository
+	ErrUnbornBranch = errors.New("HEAD points to an unborn branch")
+	// ErrInvalidRefName is returned for reference names git check-ref-format rejects
+	ErrInvalidRefName = errors.New("invalid reference name")
+)
+
+type Ref struct {
+	Name   string   // full name, such as "HEAD" or "refs/heads/main"
+	Hash   ObjectID // hash the reference points to, once resolved
+	Target string   // name of the target reference for symbolic references, empty otherwise
+	Peeled ObjectID // hash of the peeled object for annotated tags, when known from packed-refs
+}
+
+func (ref Ref) IsSymbolic() bool {
+	return ref.Target != ""
+}
+
+// packedRefs holds the parsed packed-refs file, which is read again once its size or modification time change.
+// Copies of a repository share it.
+type packedRefs struct {
+	mu      sync.Mutex
+	size    int64
+	modTime time.Time
+	refs    map[string]Ref // nil until read
+}
+
+func (repo Repository) GetGitDir() string {
+	return path.Join(repo.Path, ".git")
+}
+
+// CheckRefName checks a reference name against git check-ref-format's rules, with one level names such as HEAD
+// allowed, so it can't point out of the refs of the repository
+func CheckRefName(name string) error {
+	if name == "" || name == "@" || strings.HasSuffix(name, ".") || strings.Contains(name, "..") ||
+		strings.Contains(name, "@{") {
+		return fmt.Errorf("%w: %q", ErrInvalidRefName, name)
+	}
+
+	for _, c := range name {
+		if c < 0x20 || c == 0x7f || strings.ContainsRune(" ~^:?*[\\", c) {
+			return fmt.Errorf("%w: %q", ErrInvalidRefName, name)
+		}
+	}
+
+	// leading, trailing and double slashes make empty components
+	for _, component := range strings.Split(name, "/") {
+		if component == "" || component[0] == '.' || strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("%w: %q", ErrInvalidRefName, name)
+		}
+	}
+
+	return nil
+}
+
+// parseRef parses the contents of a loose reference file
+func parseRef(name string, data []byte) (Ref, error) {
+	content := strings.TrimSpace(string(data))
+
+	if target, ok := strings.CutPrefix(content, "ref: "); ok {
+		return Ref{Name: name, Target: strings.TrimSpace(target)}, nil
+	}
+
+	hash, err := ParseObjectID(content)
+	if err != nil {
+		return Ref{}, fmt.Errorf("invalid reference %s: %s", name, content)
+	}
+
+	return Ref{Name: name, Hash: hash}, nil
+}
+
+// ReadPackedRefs reads the "<repo>/.git/packed-refs" file, including peeled hashes of annotated tags
+func (repo Repository) ReadPackedRefs() (map[string]Ref, error) {
+	refs, err := repo.readPackedRefs()
+	return maps.Clone(refs), err
+}
+
+// readPackedRefs returns the references of the packed-refs file, only parsing it if it changed since the last call.
+// The returned map is shared and must not be modified.
+func (repo Repository) readPackedRefs() (map[string]Ref, error) {
+	fileFD, err := os.Open(path.Join(repo.GetGitDir(), "packed-refs"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]Ref{}, nil
+		}
+		return map[string]Ref{}, err
+	}
+	defer fileFD.Close()
+
+	if repo.packedRefs == nil {
+		return parsePackedRefs(fileFD)
+	}
+
+	stat, err := fileFD.Stat()
+	if err != nil {
+		return map[string]Ref{}, err
+	}
+
+	cache := repo.packedRefs
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.refs != nil && cache.size == stat.Size() && cache.modTime.Equal(stat.ModTime()) {
+		return cache.refs, nil
+	}
+
+	refs, err := parsePackedRefs(fileFD)
+	if err != nil {
+		return refs, err
+	}
+
+	cache.refs, cache.size, cache.modTime = refs, stat.Size(), stat.ModTime()
+
+	return refs, nil
+}
+
+// parsePackedRefs parses the content of a packed-refs file
+func parsePackedRefs(reader io.Reader) (map[string]Ref, error) {
+	refs := make(map[string]Ref)
+
+	lastRef := ""
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		// "^<hash>" lines give the peeled object of the previous reference
+		if peeled, ok := strings.CutPrefix(line, "^"); ok {
+			peeledHash, err := ParseObjectID(peeled)
+			if lastRef == "" || err != nil {
+				return refs, fmt.Errorf("invalid packed-refs line: %s", line)
+			}
+			ref := refs[lastRef]
+			ref.Peeled = peeledHash
+			refs[lastRef] = ref
+			continue
+		}
+
+		hexHash, name, ok := strings.Cut(line, " ")
+		hash, err := ParseObjectID(hexHash)
+		if !ok || err != nil {
+			return refs, fmt.Errorf("invalid packed-refs line: %s", line)
+		}
+
+		refs[name] = Ref{Name: name, Hash: hash}
+		lastRef = name
+	}
+
+	return refs, scanner.Err()
+}
+
+// ListLooseRefs lists references stored as files under "<repo>/.git/refs", without resolving symbolic ones
+func (repo Repository) ListLooseRefs() (map[string]Ref, error) {
+	refs := make(map[string]Ref)
+
+	err := filepath.WalkDir(path.Join(repo.GetGitDir(), "refs"), func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		name, err := filepath.Rel(repo.GetGitDir(), filePath)
+		if err != nil {
+			return err
+		}
+		name = filepath.ToSlash(name)
+
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		ref, err := parseRef(name, data)
+		if err != nil {
+			return err
+		}
+
+		refs[name] = ref
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return refs, err
+	}
+
+	return refs, nil
+}
+
+// ReadRef reads a single reference, loose or packed, without following it if it is symbolic. The name is checked
+// with CheckRefName first.
+func (repo Repository) ReadRef(name string) (Ref, error) {
+	if err := CheckRefName(name); err != nil {
+		return Ref{}, err
+	}
+
+	data, err := os.ReadFile(path.Join(repo.GetGitDir(), name))
+	if err == nil {
+		return parseRef(name, data)
+	}
+	if !os.IsNotExist(err) {
+		return Ref{}, err
+	}
+
+	packedRefs, err := repo.readPackedRefs()
+	if err != nil {
+		return Ref{}, err
+	}
+
+	ref, ok := packedRefs[name]
+	if !ok {
+		return Ref{}, fmt.Errorf("%w: %s", ErrRefNotFound, name)
+	}
+
+	return ref, nil
+}
+
+// ResolveRef reads a reference and follows symbolic references until a hash is found. The returned Ref is the one
+// given by name, with its Hash set.
+func (repo Repository) ResolveRef(name string) (Ref, error) {
+	ref, err := repo.ReadRef(name)
+	if err != nil {
+		return Ref{}, err
+	}
+
+	resolved := ref
+	visited := map[string]bool{name: true}
+
+	for depth := 0; resolved.IsSymbolic(); depth++ {
+		if depth >= SYMREF_MAX_DEPTH || visited[resolved.Target] {
+			return Ref{}, fmt.Errorf("%w while resolving %s", ErrSymbolicRefLoop, name)
+		}
+		visited[resolved.Target] = true
+
+		if resolved, err = repo.ReadRef(resolved.Target); err != nil {
+			return Ref{}, err
+		}
+	}
+
+	ref.Hash = resolved.Hash
+	ref.Peeled = resolved.Peeled
+
+	return ref, nil
+}
+
+// ListRefs returns all references under "refs/", from both loose files and packed-refs, sorted by name. Symbolic
+// references are resolved; those which can't be are skipped.
+func (repo Repository) ListRefs() ([]Ref, error) {
+	refs, err := repo.ReadPackedRefs()
+	if err != nil {
+		return []Ref{}, err
+	}
+
+	looseRefs, err := repo.ListLooseRefs()
+	if err != nil {
+		return []Ref{}, err
+	}
+
+	// loose references take precedence over packed ones
+	for name, ref := range looseRefs {
+		refs[name] = ref
+	}
+
+	result := make([]Ref, 0, len(refs))
+	for name, ref := range refs {
+		if !strings.HasPrefix(name, "refs/") {
+			continue
+		}
+
+		if ref.IsSymbolic() {
+			if ref, err = repo.ResolveRef(name); err != nil {
+				continue
+			}
+		}
+
+		result = append(result, ref)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
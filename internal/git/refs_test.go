@@ -0,0 +1,55 @@
+package git
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+)
+
+func TestCheckRefName(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	names := []string{
+		"HEAD", "refs/heads/main", "refs/tags/v1.0", "refs/heads/feature/a-b_c", "refs/heads/@", "refs/heads/a@b",
+		"../../../../tmp/evilref", "/refs/heads/main", "refs/heads/main/", "refs//heads", "refs/heads/.hidden",
+		"refs/heads/main.lock", "refs/heads/a..b", "refs/heads/a.", "refs/heads/a@{1}", "@", "refs/heads/a b",
+		"refs/heads/a~1", "refs/heads/a^", "refs/heads/a:b", "refs/heads/a?", "refs/heads/a*", "refs/heads/a[",
+		"refs/heads/a\\b", "refs/heads/a\x01", "refs/heads/a\x7f", "",
+	}
+
+	for _, name := range names {
+		valid := exec.Command("git", "check-ref-format", "--allow-onelevel", name).Run() == nil
+
+		err := CheckRefName(name)
+		if valid && err != nil {
+			t.Errorf("CheckRefName(%q) returned %v, expected a valid name", name, err)
+		}
+		if !valid && !errors.Is(err, ErrInvalidRefName) {
+			t.Errorf("CheckRefName(%q) returned %v, expected an invalid name", name, err)
+		}
+	}
+}
+
+func TestReadPackedRef(t *testing.T) {
+	repo := newTestRepo(t)
+	a := repo.commit("a", 1000)
+	b := repo.commit("b", 1001, "a")
+	repo.git(nil, "pack-refs", "--all")
+	repository := repo.open(false)
+
+	ref, err := repository.ReadRef("refs/tags/a")
+	if err != nil || ref.Hash.String() != a {
+		t.Fatalf("ReadRef returned %s, %v, expected %s", ref.Hash, err, a)
+	}
+
+	// the packed-refs file is read again once rewritten
+	repo.git(nil, "update-ref", "refs/tags/a", b)
+	repo.git(nil, "pack-refs", "--all")
+
+	ref, err = repository.ReadRef("refs/tags/a")
+	if err != nil || ref.Hash.String() != b {
+		t.Errorf("ReadRef returned %s, %v, expected %s", ref.Hash, err, b)
+	}
+}
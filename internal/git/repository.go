@@ -1,15 +1,25 @@
 package git
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
-	"strings"
 )
 
 type Repository struct {
-	Path    string
-	Objects map[string]Object
+	Path         string
+	ObjectFormat ObjectFormat          // hash algorithm naming objects
+	Packs        map[string]*PackIndex // by pack file name
+	packFiles    []string              // pack file names, in lookup order
+
+	MultiPackIndex *MultiPackIndex // nil if the repository has no multi-pack-index
+	CommitGraph    *CommitGraph    // nil if the repository has no commit-graph
+
+	// Delta bases, shared by copies of the repository. Set to nil to disable caching, or replace it for another size.
+	DeltaBaseCache *DeltaBaseCache
+
+	packedRefs *packedRefs
 }
 
 // OpenRepository opens a repository
@@ -26,18 +36,52 @@ func OpenRepository(repopath string) (Repository, error) {
 
 	repository := Repository{
 		Path: repopath,
+
+		DeltaBaseCache: NewDeltaBaseCache(DEFAULT_DELTA_BASE_CACHE_SIZE),
+		packedRefs:     &packedRefs{},
 	}
 
-	objects, err := repository.ListObjects()
+	// Hashes are SHA-1 ones unless the repository was created with another object format
+	objectFormat, ok, err := repository.GetConfigValue("extensions.objectformat")
 	if err != nil {
 		return Repository{}, err
 	}
+	if ok {
+		if repository.ObjectFormat, err = ParseObjectFormat(objectFormat); err != nil {
+			return Repository{}, err
+		}
+	}
 
-	repository.Objects = objects
+	// Objects are looked up in the packs' indexes as they are needed, rather than listed here
+	if repository.Packs, repository.packFiles, err = repository.openPackIndexes(); err != nil {
+		return Repository{}, err
+	}
+
+	// An unreadable multi-pack-index is ignored, as each pack's .idx can be used instead
+	if midx, err := repository.OpenMultiPackIndex(); err == nil {
+		repository.MultiPackIndex = midx
+	}
+
+	// Same for the commit-graph, as commits can be read from their objects
+	if graph, err := repository.OpenCommitGraph(); err == nil {
+		repository.CommitGraph = graph
+	}
 
 	return repository, nil
 }
 
+// Close releases the repository's pack files. Copies of the repository share them, so none of them can read packed
+// objects anymore.
+func (repo Repository) Close() error {
+	var errs []error
+
+	for _, index := range repo.Packs {
+		errs = append(errs, index.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
 func (repo Repository) GetObjectsDir() string {
 	return path.Join(repo.Path, ".git/objects")
 }
@@ -46,18 +90,47 @@ func (repo Repository) GetPackDir() string {
 	return path.Join(repo.GetObjectsDir(), "pack")
 }
 
-func (repo Repository) GetCurrentRef() (string, error) {
-	data, err := os.ReadFile(path.Join(repo.Path, ".git/HEAD"))
+// Head describes what HEAD points to
+type Head struct {
+	Hash     ObjectID // commit hash, null if the branch is unborn
+	Branch   string   // reference HEAD points to, such as "refs/heads/main"; empty if detached
+	Detached bool     // true if HEAD directly contains a hash
+}
+
+// GetHead reads HEAD, which either contains a hash (detached HEAD) or points to a branch. If that branch does not
+// exist yet, the returned Head has its Branch set and the error is ErrUnbornBranch.
+func (repo Repository) GetHead() (Head, error) {
+	ref, err := repo.ReadRef("HEAD")
 	if err != nil {
-		return "", err
+		return Head{}, err
+	}
+
+	if !ref.IsSymbolic() {
+		return Head{Hash: ref.Hash, Detached: true}, nil
 	}
 
-	parts := strings.SplitN(strings.TrimSpace(string(data)), ": ", 2)
+	head := Head{Branch: ref.Target}
+
+	ref, err = repo.ResolveRef("HEAD")
+	if err != nil {
+		if errors.Is(err, ErrRefNotFound) {
+			return head, fmt.Errorf("%w: %s", ErrUnbornBranch, head.Branch)
+		}
+		return head, err
+	}
+
+	head.Hash = ref.Hash
+
+	return head, nil
+}
 
-	data, err = os.ReadFile(path.Join(repo.Path, ".git", parts[1]))
+// GetCurrentRef returns the hash HEAD points to, whether HEAD is detached or not. It returns ErrUnbornBranch if
+// HEAD points to a branch without any commit.
+func (repo Repository) GetCurrentRef() (ObjectID, error) {
+	head, err := repo.GetHead()
 	if err != nil {
-		return "", err
+		return ObjectID{}, err
 	}
 
-	return strings.TrimSpace(string(data)), nil
+	return head.Hash, nil
 }
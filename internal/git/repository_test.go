@@ -0,0 +1,67 @@
+package git
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSHA256Repository(t *testing.T) {
+	repo := newTestRepo(t, "--object-format=sha256")
+	names := repo.writeHistory()
+	repo.git(nil, "tag", "-a", "-m", "annotated", "annotated", names[len(names)-1])
+
+	// loose objects first, then packed ones with deltas against their base's hash, along with a reverse index,
+	// a multi-pack-index and a commit-graph
+	repo.checkObjects(repo.open(false))
+
+	repo.git(nil, "-c", "repack.useDeltaBaseOffset=false", "-c", "pack.writeReverseIndex=true", "repack", "-adq")
+	repo.git(nil, "multi-pack-index", "write")
+	repository := repo.open(true)
+
+	if repository.ObjectFormat != OBJECT_FORMAT_SHA256 {
+		t.Fatalf("the repository's object format is %v", repository.ObjectFormat)
+	}
+	if repository.MultiPackIndex == nil || repository.CommitGraph == nil {
+		t.Fatal("the multi-pack-index or the commit-graph was not opened")
+	}
+
+	repo.checkObjects(repository)
+
+	for _, rev := range []string{"annotated", "annotated^{}", "annotated^{tree}", "v3~2", "v4:src/main.go", ":/v2"} {
+		hash, err := repository.ResolveRevision(rev)
+		if expected := repo.git(nil, "rev-parse", rev); err != nil || hash.String() != expected {
+			t.Errorf("ResolveRevision(%q) returned %s, %v, expected %s", rev, hash, err, expected)
+		}
+	}
+
+	walk := repository.NewRevWalk()
+	if err := walk.Push("v1..annotated"); err != nil {
+		t.Fatal(err)
+	}
+	commits, err := walk.Commits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hashes := make([]string, 0, len(commits))
+	for _, commit := range commits {
+		hashes = append(hashes, commit.Hash.String())
+	}
+	if expected := strings.Split(repo.git(nil, "rev-list", "v1..annotated"), "\n"); !slices.Equal(hashes, expected) {
+		t.Errorf("rev-list v1..annotated = %v, expected %v", hashes, expected)
+	}
+
+	oldTree, _ := repository.ResolveRevision("v0^{tree}")
+	newTree, _ := repository.ResolveRevision("v4^{tree}")
+	changes, err := repository.DiffTrees(oldTree, newTree, &DiffOptions{DetectRenames: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]string, 0, len(changes))
+	for _, change := range changes {
+		got = append(got, string(change.Type)+"\t"+change.Path())
+	}
+	if expected := repo.git(nil, "diff", "--name-status", "v0", "v4"); strings.Join(got, "\n") != expected {
+		t.Errorf("diff --name-status v0 v4:\n%s\nexpected:\n%s", strings.Join(got, "\n"), expected)
+	}
+}
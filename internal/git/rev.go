@@ -0,0 +1,447 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// prefixes tried, in order, to expand a short reference name into a full one, like git does
+var refLookupRules = []string{
+	"%s",
+	"refs/%s",
+	"refs/tags/%s",
+	"refs/heads/%s",
+	"refs/remotes/%s",
+	"refs/remotes/%s/HEAD",
+}
+
+func isHex(value string) bool {
+	for _, c := range value {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// openResolvedObject opens an object and applies its delta, if any
+func (repo Repository) openResolvedObject(hash ObjectID) (Object, error) {
+	object, err := repo.OpenObject(hash)
+	if err != nil {
+		return Object{}, err
+	}
+
+	return repo.ApplyDelta(object)
+}
+
+// ResolveRevision resolves a revision expression, as understood by git rev-parse, into an object hash. Supported:
+// full & abbreviated hashes, HEAD/@, branch & tag names, rev~N, rev^N, rev^{type}, rev^{}, rev^{/regex}, rev@{N},
+// rev:path/to/file, :/regex and :/!-regex.
+func (repo Repository) ResolveRevision(rev string) (ObjectID, error) {
+	if rev == "" {
+		return ObjectID{}, fmt.Errorf("empty revision")
+	}
+
+	// ":/regex" is the youngest commit reachable from any reference whose message matches regex
+	if pattern, ok := strings.CutPrefix(rev, ":/"); ok {
+		starts, err := repo.allRefsHashes()
+		if err != nil {
+			return ObjectID{}, err
+		}
+		return repo.searchCommitMessage(starts, pattern)
+	}
+
+	if rev[0] == ':' {
+		return ObjectID{}, fmt.Errorf("index lookups are not supported: %s", rev)
+	}
+
+	// "rev:path" is the object at path in rev's tree. The ':' is searched outside of "^{...}" blocks, which may
+	// contain a regex.
+	depth := 0
+	for n, c := range rev {
+		switch {
+		case c == '{':
+			depth++
+		case c == '}' && depth > 0:
+			depth--
+		case c == ':' && depth == 0:
+			hash, err := repo.ResolveRevision(rev[:n])
+			if err != nil {
+				return ObjectID{}, err
+			}
+
+			treeHash, err := repo.peelToType(hash, OBJECT_TYPE_TREE)
+			if err != nil {
+				return ObjectID{}, err
+			}
+
+			entry, err := repo.LookupPath(treeHash, rev[n+1:])
+			return entry.Hash, err
+		}
+	}
+
+	base := rev
+	if n := strings.IndexAny(rev, "~^"); n >= 0 {
+		base = rev[:n]
+	}
+	if n := strings.Index(base, "@{"); n >= 0 {
+		base = base[:n]
+	}
+
+	hash, err := repo.resolveRevisionBase(base)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	return repo.applyRevisionSuffixes(base, hash, rev[len(base):])
+}
+
+// resolveRevisionBase resolves the leading part of a revision: a hash or a reference name
+func (repo Repository) resolveRevisionBase(base string) (ObjectID, error) {
+	if base == "" || base == "@" {
+		base = "HEAD"
+	}
+
+	// a full hash of another format is tried as a prefix below
+	if hash, err := ParseObjectID(base); err == nil && hash.Format() == repo.ObjectFormat {
+		return hash, nil
+	}
+
+	if name, err := repo.expandRefName(base); err == nil {
+		ref, err := repo.ResolveRef(name)
+		if err != nil {
+			return ObjectID{}, err
+		}
+		return ref.Hash, nil
+	}
+
+	if len(base) >= MIN_ABBREV_LEN && isHex(base) {
+		return repo.ResolvePrefix(base)
+	}
+
+	return ObjectID{}, fmt.Errorf("unknown revision: %s", base)
+}
+
+// expandRefName returns the full name of the first existing reference matching a short name
+func (repo Repository) expandRefName(name string) (string, error) {
+	for _, rule := range refLookupRules {
+		fullName := fmt.Sprintf(rule, name)
+		if _, err := repo.ReadRef(fullName); err == nil {
+			return fullName, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrRefNotFound, name)
+}
+
+// readSuffixNumber reads the optional number following a '~' or '^' operator
+func readSuffixNumber(suffixes string) (int, string, error) {
+	end := 0
+	for end < len(suffixes) && suffixes[end] >= '0' && suffixes[end] <= '9' {
+		end++
+	}
+
+	if end == 0 {
+		return 1, suffixes, nil
+	}
+
+	number, err := strconv.Atoi(suffixes[:end])
+	return number, suffixes[end:], err
+}
+
+// applyRevisionSuffixes applies, from left to right, the "@{N}", "~N", "^N" and "^{...}" operators to hash
+func (repo Repository) applyRevisionSuffixes(base string, hash ObjectID, suffixes string) (ObjectID, error) {
+	var err error
+
+	if strings.HasPrefix(suffixes, "@{") {
+		end := strings.IndexByte(suffixes, '}')
+		if end < 0 {
+			return ObjectID{}, fmt.Errorf("invalid revision suffix: %s", suffixes)
+		}
+
+		if hash, err = repo.resolveReflogEntry(base, suffixes[2:end]); err != nil {
+			return ObjectID{}, err
+		}
+		suffixes = suffixes[end+1:]
+	}
+
+	for suffixes != "" {
+		operator := suffixes[0]
+		suffixes = suffixes[1:]
+
+		switch {
+		case operator == '^' && strings.HasPrefix(suffixes, "{"):
+			end := strings.IndexByte(suffixes, '}')
+			if end < 0 {
+				return ObjectID{}, fmt.Errorf("invalid revision suffix: ^%s", suffixes)
+			}
+			peel := suffixes[1:end]
+			suffixes = suffixes[end+1:]
+
+			switch {
+			case peel == "":
+				object, err := repo.Peel(hash)
+				if err != nil {
+					return ObjectID{}, err
+				}
+				hash = object.Hash
+			case peel == "object":
+				if _, err = repo.OpenObject(hash); err != nil {
+					return ObjectID{}, err
+				}
+			case strings.HasPrefix(peel, "/"):
+				if hash, err = repo.peelToType(hash, OBJECT_TYPE_COMMIT); err != nil {
+					return ObjectID{}, err
+				}
+				if hash, err = repo.searchCommitMessage([]ObjectID{hash}, peel[1:]); err != nil {
+					return ObjectID{}, err
+				}
+			default:
+				if hash, err = repo.peelToType(hash, ObjectType(peel)); err != nil {
+					return ObjectID{}, err
+				}
+			}
+
+		case operator == '~':
+			var count int
+			if count, suffixes, err = readSuffixNumber(suffixes); err != nil {
+				return ObjectID{}, err
+			}
+
+			for range count {
+				commit, err := repo.openCommitish(hash)
+				if err != nil {
+					return ObjectID{}, err
+				}
+				if len(commit.Parents) == 0 {
+					return ObjectID{}, fmt.Errorf("commit %s has no parent", commit.Hash)
+				}
+				hash = commit.Parents[0]
+			}
+
+		case operator == '^':
+			var number int
+			if number, suffixes, err = readSuffixNumber(suffixes); err != nil {
+				return ObjectID{}, err
+			}
+
+			commit, err := repo.openCommitish(hash)
+			if err != nil {
+				return ObjectID{}, err
+			}
+
+			if number == 0 {
+				hash = commit.Hash
+			} else if number > len(commit.Parents) {
+				return ObjectID{}, fmt.Errorf("commit %s has no parent #%d", commit.Hash, number)
+			} else {
+				hash = commit.Parents[number-1]
+			}
+
+		default:
+			return ObjectID{}, fmt.Errorf("invalid revision suffix: %c%s", operator, suffixes)
+		}
+	}
+
+	return hash, nil
+}
+
+// openCommitish peels an object to a commit and opens it
+func (repo Repository) openCommitish(hash ObjectID) (*Commit, error) {
+	hash, err := repo.peelToType(hash, OBJECT_TYPE_COMMIT)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.OpenCommit(hash)
+}
+
+// peelToType follows tags, and commits to their tree, until an object of the wanted type is found
+func (repo Repository) peelToType(hash ObjectID, objectType ObjectType) (ObjectID, error) {
+	switch objectType {
+	case OBJECT_TYPE_COMMIT, OBJECT_TYPE_TREE, OBJECT_TYPE_BLOB, OBJECT_TYPE_TAG:
+	default:
+		return ObjectID{}, fmt.Errorf("invalid object type: %s", objectType)
+	}
+
+	for {
+		object, err := repo.openResolvedObject(hash)
+		if err != nil {
+			return ObjectID{}, err
+		}
+
+		if object.Type == objectType {
+			return hash, nil
+		}
+
+		switch object.Type {
+		case OBJECT_TYPE_TAG:
+			tag, err := ParseTag(object.Content)
+			if err != nil {
+				return ObjectID{}, err
+			}
+			hash = tag.Object
+
+		case OBJECT_TYPE_COMMIT:
+			if objectType != OBJECT_TYPE_TREE {
+				return ObjectID{}, fmt.Errorf("object %s can't be peeled to a %s", hash, objectType)
+			}
+
+			commit, err := ParseCommit(object.Content)
+			if err != nil {
+				return ObjectID{}, err
+			}
+			hash = commit.Tree
+
+		default:
+			return ObjectID{}, fmt.Errorf("object %s is a %s, not a %s", hash, object.Type, objectType)
+		}
+	}
+}
+
+// resolveReflogEntry returns the hash a reference pointed to, N changes ago, using "<repo>/.git/logs/<ref>"
+func (repo Repository) resolveReflogEntry(base, selector string) (ObjectID, error) {
+	count, err := strconv.Atoi(selector)
+	if err != nil || count < 0 {
+		return ObjectID{}, fmt.Errorf("unsupported reflog selector: @{%s}", selector)
+	}
+
+	// "@{N}" alone refers to the current branch, not HEAD
+	name := "HEAD"
+	if base != "" && base != "@" {
+		if name, err = repo.expandRefName(base); err != nil {
+			return ObjectID{}, err
+		}
+	} else if head, err := repo.GetHead(); err == nil && !head.Detached {
+		name = head.Branch
+	}
+
+	data, err := os.ReadFile(path.Join(repo.GetGitDir(), "logs", name))
+	if err != nil {
+		return ObjectID{}, fmt.Errorf("could not read reflog for %s: %w", name, err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if count > len(lines) {
+		return ObjectID{}, fmt.Errorf("reflog for %s only has %d entries", name, len(lines))
+	}
+
+	// entries are stored oldest first as "<old hash> <new hash> <signature>\t<message>"
+	if count == len(lines) {
+		fields := strings.Fields(lines[0])
+		if len(fields) < 2 {
+			return ObjectID{}, fmt.Errorf("invalid reflog entry for %s", name)
+		}
+
+		hash, err := ParseObjectID(fields[0])
+		if err != nil {
+			return ObjectID{}, fmt.Errorf("invalid reflog entry for %s", name)
+		}
+		if hash.IsZero() {
+			return ObjectID{}, fmt.Errorf("reflog for %s only has %d entries", name, len(lines))
+		}
+		return hash, nil
+	}
+
+	fields := strings.Fields(lines[len(lines)-1-count])
+	if len(fields) < 2 {
+		return ObjectID{}, fmt.Errorf("invalid reflog entry for %s", name)
+	}
+
+	hash, err := ParseObjectID(fields[1])
+	if err != nil {
+		return ObjectID{}, fmt.Errorf("invalid reflog entry for %s", name)
+	}
+
+	return hash, nil
+}
+
+// allRefsHashes returns the hashes of HEAD and all references
+func (repo Repository) allRefsHashes() ([]ObjectID, error) {
+	hashes := make([]ObjectID, 0)
+
+	if head, err := repo.GetHead(); err == nil {
+		hashes = append(hashes, head.Hash)
+	}
+
+	refs, err := repo.ListRefs()
+	if err != nil {
+		return hashes, err
+	}
+
+	for _, ref := range refs {
+		hashes = append(hashes, ref.Hash)
+	}
+
+	return hashes, nil
+}
+
+// searchCommitMessage returns the youngest commit reachable from starts whose message matches pattern. As in git, a
+// pattern starting with "!-" looks for a message which does not match the rest of it, and "!!" stands for a literal
+// '!'. Other patterns starting with '!' are reserved.
+func (repo Repository) searchCommitMessage(starts []ObjectID, pattern string) (ObjectID, error) {
+	negative := false
+	if expression, ok := strings.CutPrefix(pattern, "!"); ok {
+		switch {
+		case strings.HasPrefix(expression, "-"):
+			negative = true
+			expression = expression[1:]
+		case !strings.HasPrefix(expression, "!"):
+			return ObjectID{}, fmt.Errorf("unsupported message search: %s", pattern)
+		}
+		pattern = expression
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	queue := &commitQueue{}
+	seen := make(map[ObjectID]bool)
+
+	for _, hash := range starts {
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		// references may point to other objects than commits, such as tags of trees
+		commit, err := repo.openCommitish(hash)
+		if err != nil {
+			continue
+		}
+		queue.PushCommit(commit)
+	}
+
+	for queue.Len() > 0 {
+		commit := queue.PopCommit()
+
+		if re.MatchString(commit.Message) != negative {
+			return commit.Hash, nil
+		}
+
+		for _, parent := range commit.Parents {
+			if seen[parent] {
+				continue
+			}
+			seen[parent] = true
+
+			parentCommit, err := repo.OpenCommit(parent)
+			if err != nil {
+				return ObjectID{}, err
+			}
+			queue.PushCommit(parentCommit)
+		}
+	}
+
+	if negative {
+		return ObjectID{}, fmt.Errorf("every commit message matches %s", pattern)
+	}
+	return ObjectID{}, fmt.Errorf("no commit message matches %s", pattern)
+}
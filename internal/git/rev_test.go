@@ -0,0 +1,38 @@
+package git
+
+import (
+	"testing"
+)
+
+func TestResolveRevision(t *testing.T) {
+	repo := newTestRepo(t)
+	repo.commit("a", 1000)
+	repo.commit("fix!", 1001, "a")
+	repo.commit("b", 1002, "fix!")
+	repo.commit("side", 1003, "a")
+	repo.commit("merge", 1004, "b", "side")
+	repo.git(nil, "update-ref", "refs/heads/main", repo.commits["merge"])
+	repo.git(nil, "symbolic-ref", "HEAD", "refs/heads/main")
+	repository := repo.open(false)
+
+	revs := []string{
+		"HEAD", "main", "merge~1", "merge^2", "HEAD~2", "b^{commit}",
+		":/fix", ":/^b", ":/!-merge", ":/!-.", ":/!!", ":/!-!",
+		"merge^{/side}", "merge^{/!-merge}", "merge^{/!!}", "b^{/!-b}",
+		":/!x", ":/!", ":/nothing",
+	}
+
+	for _, rev := range revs {
+		expected, gitErr := repo.tryGit(nil, "rev-parse", "--verify", "-q", rev)
+
+		hash, err := repository.ResolveRevision(rev)
+		switch {
+		case gitErr != nil && err == nil:
+			t.Errorf("ResolveRevision(%q) = %s, expected an error", rev, hash)
+		case gitErr == nil && err != nil:
+			t.Errorf("ResolveRevision(%q) returned %v, expected %s", rev, err, expected)
+		case gitErr == nil && hash.String() != expected:
+			t.Errorf("ResolveRevision(%q) = %s, expected %s", rev, hash, expected)
+		}
+	}
+}
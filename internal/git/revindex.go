@@ -0,0 +1,112 @@
+package git
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+)
+
+// loadRevIndex sets the reverse index, allowing to find an object by its offset in the pack file. It is read from
+// the pack's .rev file if there is one; otherwise it is computed by sorting the objects by offset.
+func (index *PackIndex) loadRevIndex(repo Repository) error {
+	index.revMu.Lock()
+	defer index.revMu.Unlock()
+
+	if index.revIndex != nil {
+		return nil
+	}
+
+	revIndex, err := repo.OpenPackRev(index.revDirEntry, uint32(index.Len()))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	offsets := make([]int64, index.Len())
+	for n := range offsets {
+		if offsets[n], err = index.OffsetAt(n); err != nil {
+			return err
+		}
+	}
+
+	if revIndex == nil {
+		revIndex = make([]uint32, index.Len())
+		for n := range revIndex {
+			revIndex[n] = uint32(n)
+		}
+
+		sort.Slice(revIndex, func(i, j int) bool {
+			return offsets[revIndex[i]] < offsets[revIndex[j]]
+		})
+	}
+
+	index.revOffsets = make([]int64, len(revIndex))
+	for n, position := range revIndex {
+		index.revOffsets[n] = offsets[position]
+	}
+	index.revIndex = revIndex
+
+	return nil
+}
+
+// OpenPackRev opens and parses a .rev file, returning the .idx positions of the objects sorted by pack offset
+func (repo Repository) OpenPackRev(revDirEntry string, entriesNum uint32) ([]uint32, error) {
+	fileFD, err := os.Open(path.Join(repo.GetPackDir(), revDirEntry))
+	if err != nil {
+		return nil, err
+	}
+	defer fileFD.Close()
+
+	reader := bufio.NewReader(fileFD)
+
+	header := make([]byte, 12)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(header[0:4], []byte("RIDX")) {
+		return nil, fmt.Errorf("invalid header for reverse index %s", revDirEntry)
+	}
+	if version := binary.BigEndian.Uint32(header[4:8]); version != 1 {
+		return nil, fmt.Errorf("%w for reverse index %s: %d", ErrUnsupportedVersion, revDirEntry, version)
+	}
+	if hashId := binary.BigEndian.Uint32(header[8:12]); hashId != repo.ObjectFormat.HashId() {
+		return nil, fmt.Errorf("unsupported hash function for reverse index %s: %d", revDirEntry, hashId)
+	}
+
+	revIndex := make([]uint32, entriesNum)
+	for n := range entriesNum {
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(reader, buf); err != nil {
+			return nil, err
+		}
+
+		revIndex[n] = binary.BigEndian.Uint32(buf)
+		if revIndex[n] >= entriesNum {
+			return nil, fmt.Errorf("invalid position in reverse index %s: %d", revDirEntry, revIndex[n])
+		}
+	}
+
+	return revIndex, nil
+}
+
+// LookupOffset returns the hash of the object stored at the given offset in the pack file. The reverse index is
+// loaded on first use.
+func (index *PackIndex) LookupOffset(repo Repository, offset int64) (ObjectID, bool, error) {
+	if err := index.loadRevIndex(repo); err != nil {
+		return ObjectID{}, false, err
+	}
+
+	n := sort.Search(len(index.revOffsets), func(i int) bool {
+		return index.revOffsets[i] >= offset
+	})
+
+	if n == len(index.revOffsets) || index.revOffsets[n] != offset {
+		return ObjectID{}, false, nil
+	}
+
+	return index.HashAt(int(index.revIndex[n])), true, nil
+}
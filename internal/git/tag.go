@@ -0,0 +1,146 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// signature armors which can be appended to an annotated tag's message
+var tagSignatureHeaders = []string{
+	"-----BEGIN PGP SIGNATURE-----",
+	"-----BEGIN PGP MESSAGE-----",
+	"-----BEGIN SSH SIGNATURE-----",
+	"-----BEGIN SIGNED MESSAGE-----",
+}
+
+type Tag struct {
+	Hash         ObjectID
+	Object       ObjectID
+	Type         ObjectType
+	Name         string
+	Tagger       *Signature // nil for old tags without a tagger
+	ExtraHeaders []CommitHeader
+	Message      string
+	Signature    string // armored signature, removed from the message
+}
+
+// ParseTag parses an annotated tag object's contents
+func ParseTag(data []byte) (*Tag, error) {
+	headers, message, err := parseHeaders(data)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := &Tag{
+		ExtraHeaders: make([]CommitHeader, 0),
+		Message:      message,
+	}
+
+	for _, header := range headers {
+		switch header.Key {
+		case "object":
+			if tag.Object, err = ParseObjectID(header.Value); err != nil {
+				return nil, fmt.Errorf("invalid tag object: %w", err)
+			}
+		case "type":
+			tag.Type = ObjectType(header.Value)
+		case "tag":
+			tag.Name = header.Value
+		case "tagger":
+			tagger, err := ParseSignature(header.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag.Tagger = &tagger
+		default:
+			tag.ExtraHeaders = append(tag.ExtraHeaders, header)
+		}
+	}
+
+	if tag.Object.IsZero() || tag.Type == "" {
+		return nil, fmt.Errorf("invalid tag: missing object or type")
+	}
+
+	// The signature is the last armored block starting at the beginning of a line
+	for _, signatureHeader := range tagSignatureHeaders {
+		idx := strings.LastIndex(tag.Message, signatureHeader)
+		if idx < 0 || (idx > 0 && tag.Message[idx-1] != '\n') {
+			continue
+		}
+
+		tag.Signature = tag.Message[idx:]
+		tag.Message = tag.Message[:idx]
+		break
+	}
+
+	return tag, nil
+}
+
+// OpenTag opens an annotated tag object by its hash and parses it
+func (repo Repository) OpenTag(hash ObjectID) (*Tag, error) {
+	object, err := repo.OpenObject(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if object, err = repo.ApplyDelta(object); err != nil {
+		return nil, err
+	}
+	if object.Type != OBJECT_TYPE_TAG {
+		return nil, fmt.Errorf("object %s is a %s, not a tag", hash, object.Type)
+	}
+
+	tag, err := ParseTag(object.Content)
+	if err != nil {
+		return nil, err
+	}
+	tag.Hash = hash
+
+	return tag, nil
+}
+
+// Peel opens an object and, as long as it is an annotated tag, follows the tagged object. It returns the first
+// object which is not a tag (commit, tree or blob), with delta applied.
+func (repo Repository) Peel(hash ObjectID) (Object, error) {
+	for {
+		object, err := repo.OpenObject(hash)
+		if err != nil {
+			return Object{}, err
+		}
+
+		if object, err = repo.ApplyDelta(object); err != nil {
+			return Object{}, err
+		}
+		if object.Type != OBJECT_TYPE_TAG {
+			return object, nil
+		}
+
+		tag, err := ParseTag(object.Content)
+		if err != nil {
+			return Object{}, err
+		}
+
+		hash = tag.Object
+	}
+}
+
+// String returns the tag in its canonical form, as stored in the object
+func (tag *Tag) String() string {
+	out := strings.Builder{}
+
+	writeHeader(&out, "object", tag.Object.String())
+	writeHeader(&out, "type", string(tag.Type))
+	writeHeader(&out, "tag", tag.Name)
+	if tag.Tagger != nil {
+		writeHeader(&out, "tagger", tag.Tagger.String())
+	}
+	for _, header := range tag.ExtraHeaders {
+		writeHeader(&out, header.Key, header.Value)
+	}
+
+	out.WriteString("\n")
+	out.WriteString(tag.Message)
+	out.WriteString(tag.Signature)
+
+	return out.String()
+}
@@ -0,0 +1,201 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"testing"
+)
+
+// testRepo is a repository created with git in a temporary directory, whose commits are written with commit-tree
+// so their dates and parents are chosen by the test
+type testRepo struct {
+	t       *testing.T
+	dir     string
+	commits map[string]string // hashes by name
+	count   int
+}
+
+// newTestRepo creates an empty repository, giving git init the extra arguments if any
+func newTestRepo(t *testing.T, initArgs ...string) *testRepo {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	repo := &testRepo{t: t, dir: t.TempDir(), commits: make(map[string]string)}
+	repo.git(nil, append([]string{"init", "-q"}, initArgs...)...)
+
+	return repo
+}
+
+// git runs a git command in the repository and returns its trimmed output
+func (repo *testRepo) git(env []string, args ...string) string {
+	repo.t.Helper()
+
+	out, err := repo.tryGit(env, args...)
+	if err != nil {
+		repo.t.Fatalf("git %s: %v", strings.Join(args, " "), err)
+	}
+
+	return out
+}
+
+// tryGit runs a git command like git, but returns its error instead of failing the test
+func (repo *testRepo) tryGit(env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repo.dir
+	cmd.Env = append(os.Environ(),
+		"GIT_CONFIG_GLOBAL=/dev/null",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=A", "GIT_AUTHOR_EMAIL=a@example.com",
+		"GIT_COMMITTER_NAME=C", "GIT_COMMITTER_EMAIL=c@example.com",
+	)
+	cmd.Env = append(cmd.Env, env...)
+
+	out, err := cmd.Output()
+
+	return strings.TrimSpace(string(out)), err
+}
+
+// commit writes a commit of an empty tree with the given committer date, in seconds, and parents, given by name.
+// The commit is named after its message, and returned branches and tags can use that name.
+func (repo *testRepo) commit(name string, date int64, parents ...string) string {
+	repo.t.Helper()
+
+	return repo.commitTree(name, repo.tree(nil), date, parents...)
+}
+
+// commitTree writes a commit of the given tree, as commit does
+func (repo *testRepo) commitTree(name, tree string, date int64, parents ...string) string {
+	repo.t.Helper()
+
+	args := []string{"commit-tree", tree, "-m", name}
+	for _, parent := range parents {
+		args = append(args, "-p", repo.commits[parent])
+	}
+
+	dateEnv := fmt.Sprintf("@%d +0000", date)
+	hash := repo.git([]string{"GIT_AUTHOR_DATE=" + dateEnv, "GIT_COMMITTER_DATE=" + dateEnv}, args...)
+
+	repo.commits[name] = hash
+	repo.git(nil, "update-ref", "refs/tags/"+name, hash)
+
+	return hash
+}
+
+// tree writes a tree of regular files, with contents by path, and returns its hash
+func (repo *testRepo) tree(files map[string]string) string {
+	repo.t.Helper()
+
+	workTree := repo.t.TempDir()
+	for name, content := range files {
+		filePath := path.Join(workTree, name)
+		if err := os.MkdirAll(path.Dir(filePath), 0o755); err != nil {
+			repo.t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+			repo.t.Fatal(err)
+		}
+	}
+
+	env := []string{"GIT_INDEX_FILE=" + path.Join(workTree, ".index")}
+	repo.git(env, "--work-tree="+workTree, "add", "-A", "--", ".", ":!.index")
+
+	return repo.git(env, "write-tree")
+}
+
+// open opens the repository, once its commit-graph is written if withGraph is set
+func (repo *testRepo) open(withGraph bool) Repository {
+	repo.t.Helper()
+
+	if withGraph {
+		repo.git(nil, "commit-graph", "write", "--reachable")
+	}
+
+	repository, err := OpenRepository(repo.dir)
+	if err != nil {
+		repo.t.Fatal(err)
+	}
+	repo.t.Cleanup(func() { repository.Close() })
+
+	return repository
+}
+
+// names returns the names of the given commits, as given to commit
+func (repo *testRepo) names(hashes []ObjectID) []string {
+	byHash := make(map[string]string)
+	for name, hash := range repo.commits {
+		byHash[hash] = name
+	}
+
+	names := make([]string, 0, len(hashes))
+	for _, hash := range hashes {
+		names = append(names, byHash[hash.String()])
+	}
+
+	return names
+}
+
+// writeHistory writes a few commits of files changing a little from one to the other, so packing them gives deltas,
+// and returns their names, oldest first
+func (repo *testRepo) writeHistory() []string {
+	repo.t.Helper()
+
+	files := map[string]string{"README": "git-reader\n"}
+	names := make([]string, 0)
+
+	for n := range 5 {
+		var content strings.Builder
+		for line := range 200 {
+			fmt.Fprintf(&content, "line %d of version %d\n", line, min(n, line%7))
+		}
+		files["src/main.go"] = content.String()
+		files[fmt.Sprintf("doc/%d.txt", n)] = content.String()[:100*n]
+
+		name := fmt.Sprintf("v%d", n)
+		if n == 0 {
+			repo.commitTree(name, repo.tree(files), int64(1000+n))
+		} else {
+			repo.commitTree(name, repo.tree(files), int64(1000+n), names[n-1])
+		}
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// checkObjects checks every object of the repository, as listed by git, can be read, and hashes as expected
+func (repo *testRepo) checkObjects(repository Repository) {
+	repo.t.Helper()
+
+	out := repo.git(nil, "cat-file", "--batch-all-objects", "--batch-check=%(objectname) %(objecttype) %(objectsize)")
+	for _, line := range strings.Split(out, "\n") {
+		var hexHash, objectType string
+		var size int
+		if _, err := fmt.Sscan(line, &hexHash, &objectType, &size); err != nil {
+			repo.t.Fatal(err)
+		}
+
+		hash, err := ParseObjectID(hexHash)
+		if err != nil {
+			repo.t.Fatal(err)
+		}
+
+		object, err := repository.openResolvedObject(hash)
+		if err != nil {
+			repo.t.Errorf("%s: %v", hash, err)
+			continue
+		}
+
+		header := fmt.Sprintf("%s %d\x00", object.Type, len(object.Content))
+		if string(object.Type) != objectType || len(object.Content) != size ||
+			repository.ObjectFormat.Sum(append([]byte(header), object.Content...)) != hash {
+			repo.t.Errorf("%s: read a %s of %d bytes, expected a %s of %d bytes", hash, object.Type, len(object.Content),
+				objectType, size)
+		}
+	}
+}
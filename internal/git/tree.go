@@ -1,11 +1,11 @@
 package git
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -16,88 +16,177 @@ const (
 	OBJ_TYPE_SUBMODULE = 160000
 )
 
-type Blob struct {
-	Hash  string
-	Name  string
-	Perms int
+type TreeEntryKind string
+
+const (
+	TREE_ENTRY_BLOB      TreeEntryKind = "blob"
+	TREE_ENTRY_EXEC      TreeEntryKind = "exec"
+	TREE_ENTRY_SYMLINK   TreeEntryKind = "symlink"
+	TREE_ENTRY_TREE      TreeEntryKind = "tree"
+	TREE_ENTRY_SUBMODULE TreeEntryKind = "submodule"
+)
+
+// TreeEntry is an entry of a tree: a file, a symbolic link, a sub tree or a submodule. Mode holds the octal digits
+// of the entry's mode, as written in the tree (100644, 40000...).
+type TreeEntry struct {
+	Name string
+	Hash ObjectID
+	Mode int
+	Kind TreeEntryKind
+}
+
+// ObjectType returns the type of the object the entry points to
+func (entry TreeEntry) ObjectType() ObjectType {
+	switch entry.Kind {
+	case TREE_ENTRY_TREE:
+		return OBJECT_TYPE_TREE
+	case TREE_ENTRY_SUBMODULE:
+		return OBJECT_TYPE_COMMIT
+	default:
+		return OBJECT_TYPE_BLOB
+	}
 }
 
+// Tree is a parsed tree object, with its entries in the order they are stored
 type Tree struct {
-	Hash  string
-	Name  string
-	Trees map[string]Tree
-	Blobs map[string]Blob
-	Perms int
+	Entries []TreeEntry
+}
+
+// entryKind returns the kind of entry a mode is for. As git does, any regular file mode is either a blob or an
+// executable, depending on the owner's execution bit.
+func entryKind(mode int) (TreeEntryKind, error) {
+	octal, err := strconv.ParseUint(strconv.Itoa(mode), 8, 32)
+	if err != nil {
+		return "", fmt.Errorf("invalid tree entry mode: %d", mode)
+	}
+
+	switch octal & 0170000 {
+	case 0100000:
+		if octal&0100 != 0 {
+			return TREE_ENTRY_EXEC, nil
+		}
+		return TREE_ENTRY_BLOB, nil
+	case 0120000:
+		return TREE_ENTRY_SYMLINK, nil
+	case 0040000:
+		return TREE_ENTRY_TREE, nil
+	case 0160000:
+		return TREE_ENTRY_SUBMODULE, nil
+	}
+
+	return "", fmt.Errorf("invalid tree entry mode: %d", mode)
+}
+
+// QuotePath quotes a path as git does when it contains special or non-ASCII characters
+func QuotePath(name string) string {
+	quoted := false
+	var out strings.Builder
+
+	for n := 0; n < len(name); n++ {
+		c := name[n]
+
+		switch {
+		case c == '"' || c == '\\':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			if escape := strings.IndexByte("\a\b\t\n\v\f\r", c); escape != -1 {
+				out.WriteByte('\\')
+				out.WriteByte("abtnvfr"[escape])
+			} else {
+				fmt.Fprintf(&out, "\\%03o", c)
+			}
+		default:
+			out.WriteByte(c)
+			continue
+		}
+
+		quoted = true
+	}
+
+	if !quoted {
+		return name
+	}
+	return `"` + out.String() + `"`
 }
 
+// String returns the entries as git ls-tree shows them
 func (tree *Tree) String() string {
-	out := ""
+	var out strings.Builder
 
-	for _, v := range tree.Trees {
-		out += fmt.Sprintf("%06d tree %s   %s\n", v.Perms, v.Hash, v.Name)
+	for _, entry := range tree.Entries {
+		fmt.Fprintf(&out, "%06d %s %s\t%s\n", entry.Mode, entry.ObjectType(), entry.Hash, QuotePath(entry.Name))
 	}
 
-	for _, v := range tree.Blobs {
-		out += fmt.Sprintf("%06d blob %s   %s\n", v.Perms, v.Hash, v.Name)
+	return out.String()
+}
+
+// Bytes serializes the tree back into a tree object's content
+func (tree *Tree) Bytes() ([]byte, error) {
+	var out bytes.Buffer
+
+	for _, entry := range tree.Entries {
+		if entry.Hash.IsZero() {
+			return nil, fmt.Errorf("missing hash for tree entry %s", entry.Name)
+		}
+
+		fmt.Fprintf(&out, "%d %s\x00", entry.Mode, entry.Name)
+		out.Write(entry.Hash.Bytes())
 	}
 
-	return out
+	return out.Bytes(), nil
 }
 
 func (repo Repository) ConvertTree(treeData []byte) (*Tree, error) {
-	blobs := make(map[string]Blob)
-	trees := make(map[string]Tree)
+	entries := make([]TreeEntry, 0)
 
-	reader := bufio.NewReader(bytes.NewReader(treeData))
+	reader := bytes.NewReader(treeData)
 
-	for {
-		objectPermsAsStr, err := reader.ReadString(' ')
-		if err != nil {
-			if err == io.EOF {
-				break
-			} else {
-				return nil, err
-			}
+	for reader.Len() > 0 {
+		rest := treeData[len(treeData)-reader.Len():]
+
+		space := bytes.IndexByte(rest, ' ')
+		if space == -1 {
+			return nil, fmt.Errorf("invalid tree entry: missing mode")
 		}
 
-		objectPerms, err := strconv.Atoi(objectPermsAsStr[:len(objectPermsAsStr)-1])
+		objectPerms, err := strconv.Atoi(string(rest[:space]))
 		if err != nil {
 			return nil, err
 		}
 
-		objectName, err := reader.ReadBytes(0)
+		nul := bytes.IndexByte(rest[space+1:], 0)
+		if nul == -1 {
+			return nil, fmt.Errorf("invalid tree entry: missing name")
+		}
+		objectName := string(rest[space+1 : space+1+nul])
+
+		kind, err := entryKind(objectPerms)
 		if err != nil {
 			return nil, err
 		}
 
-		objectHash := make([]byte, HASH_SIZE)
+		reader.Seek(int64(space+1+nul+1), io.SeekCurrent)
+
+		objectHash := make([]byte, repo.ObjectFormat.Size())
+		if _, err := io.ReadFull(reader, objectHash); err != nil {
+			return nil, fmt.Errorf("invalid tree entry %s: truncated hash", objectName)
+		}
 
-		objectHashSize, err := reader.Read(objectHash)
+		hash, err := NewObjectID(repo.ObjectFormat, objectHash)
 		if err != nil {
 			return nil, err
 		}
-		if objectHashSize != HASH_SIZE {
-			return nil, fmt.Errorf("invalid hash size")
-		}
-		objectHashAsStr := fmt.Sprintf("%x", objectHash)
 
-		if objectPerms == OBJ_TYPE_EXEC || objectPerms == OBJ_TYPE_FILE {
-			blobs[objectHashAsStr] = Blob{
-				Hash:  objectHashAsStr,
-				Name:  string(objectName),
-				Perms: objectPerms,
-			}
-		} else if objectPerms == OBJ_TYPE_TREE {
-			trees[objectHashAsStr] = Tree{
-				Hash:  objectHashAsStr,
-				Name:  string(objectName),
-				Perms: objectPerms,
-			}
-		}
+		entries = append(entries, TreeEntry{
+			Name: objectName,
+			Hash: hash,
+			Mode: objectPerms,
+			Kind: kind,
+		})
 	}
 
 	return &Tree{
-		Blobs: blobs,
-		Trees: trees,
+		Entries: entries,
 	}, nil
 }
@@ -0,0 +1,413 @@
+package git
+
+import (
+	"hash/fnv"
+	"path"
+	"sort"
+	"strings"
+)
+
+type ChangeType byte
+
+const (
+	CHANGE_ADDED        ChangeType = 'A'
+	CHANGE_DELETED      ChangeType = 'D'
+	CHANGE_MODIFIED     ChangeType = 'M'
+	CHANGE_TYPE_CHANGED ChangeType = 'T'
+	CHANGE_RENAMED      ChangeType = 'R'
+	CHANGE_COPIED       ChangeType = 'C'
+)
+
+const (
+	// default minimum similarity, in percent, for a pair of files to be considered a rename or a copy
+	DEFAULT_RENAME_THRESHOLD = 50
+)
+
+// TreeChange is a change of a single file between two trees. Old* fields are empty, and hashes null, for added
+// files; New* fields are for deleted ones.
+type TreeChange struct {
+	Type       ChangeType
+	OldPath    string
+	NewPath    string
+	OldHash    ObjectID
+	NewHash    ObjectID
+	OldMode    int
+	NewMode    int
+	Similarity int // in percent, for renames & copies
+}
+
+// Path returns the path of the changed file, in the new tree unless the file was deleted
+func (change TreeChange) Path() string {
+	if change.Type == CHANGE_DELETED {
+		return change.OldPath
+	}
+	return change.NewPath
+}
+
+type DiffOptions struct {
+	DetectRenames    bool
+	DetectCopies     bool // copies are searched from modified files
+	FindCopiesHarder bool // copies are searched from all files of the old tree
+	RenameThreshold  int  // minimum similarity in percent, DEFAULT_RENAME_THRESHOLD if 0
+}
+
+// modeKind returns the kind of entry a mode is for: regular and executable files are of the same kind
+func modeKind(mode int) TreeEntryKind {
+	kind, _ := entryKind(mode)
+	if kind == TREE_ENTRY_EXEC {
+		return TREE_ENTRY_BLOB
+	}
+	return kind
+}
+
+// DiffTrees returns the changes between two trees, recursively, sorted by path. The null hash stands for an empty
+// tree. Renames and copies are detected if requested by options, which can be nil.
+func (repo Repository) DiffTrees(oldTree, newTree ObjectID, options *DiffOptions) ([]TreeChange, error) {
+	if options == nil {
+		options = &DiffOptions{}
+	}
+
+	changes := make([]TreeChange, 0)
+	if err := repo.diffTrees(oldTree, newTree, "", &changes); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if options.DetectRenames || options.DetectCopies || options.FindCopiesHarder {
+		if changes, err = repo.detectRenames(oldTree, changes, options); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Path() < changes[j].Path()
+	})
+
+	return changes, nil
+}
+
+func (repo Repository) diffTrees(oldTree, newTree ObjectID, prefix string, changes *[]TreeChange) error {
+	if oldTree == newTree {
+		return nil
+	}
+
+	oldEntries, err := repo.readTreeEntries(oldTree)
+	if err != nil {
+		return err
+	}
+
+	newEntries, err := repo.readTreeEntries(newTree)
+	if err != nil {
+		return err
+	}
+
+	// both lists are in tree order, and walked through together. A file and a directory of the same name don't
+	// match, the file being a deletion and the directory an addition, or the other way around.
+	for len(oldEntries) > 0 || len(newEntries) > 0 {
+		order := 0
+		switch {
+		case len(oldEntries) == 0:
+			order = 1
+		case len(newEntries) == 0:
+			order = -1
+		default:
+			order = strings.Compare(treeEntrySortName(oldEntries[0]), treeEntrySortName(newEntries[0]))
+		}
+
+		if order < 0 {
+			if err := repo.addTreeChanges(CHANGE_DELETED, oldEntries[0], path.Join(prefix, oldEntries[0].Name), changes); err != nil {
+				return err
+			}
+			oldEntries = oldEntries[1:]
+			continue
+		}
+
+		if order > 0 {
+			if err := repo.addTreeChanges(CHANGE_ADDED, newEntries[0], path.Join(prefix, newEntries[0].Name), changes); err != nil {
+				return err
+			}
+			newEntries = newEntries[1:]
+			continue
+		}
+
+		oldEntry, newEntry := oldEntries[0], newEntries[0]
+		oldEntries, newEntries = oldEntries[1:], newEntries[1:]
+		entryPath := path.Join(prefix, oldEntry.Name)
+
+		switch {
+		case oldEntry.Kind == TREE_ENTRY_TREE:
+			if err := repo.diffTrees(oldEntry.Hash, newEntry.Hash, entryPath, changes); err != nil {
+				return err
+			}
+
+		case modeKind(oldEntry.Mode) != modeKind(newEntry.Mode):
+			*changes = append(*changes, TreeChange{
+				Type:    CHANGE_TYPE_CHANGED,
+				OldPath: entryPath, NewPath: entryPath,
+				OldHash: oldEntry.Hash, NewHash: newEntry.Hash,
+				OldMode: oldEntry.Mode, NewMode: newEntry.Mode,
+			})
+
+		case oldEntry.Hash != newEntry.Hash || oldEntry.Mode != newEntry.Mode:
+			*changes = append(*changes, TreeChange{
+				Type:    CHANGE_MODIFIED,
+				OldPath: entryPath, NewPath: entryPath,
+				OldHash: oldEntry.Hash, NewHash: newEntry.Hash,
+				OldMode: oldEntry.Mode, NewMode: newEntry.Mode,
+			})
+		}
+	}
+
+	return nil
+}
+
+// treeEntrySortName returns the name an entry is sorted by in trees: sub trees sort as if followed by a slash
+func treeEntrySortName(entry TreeEntry) string {
+	if entry.Kind == TREE_ENTRY_TREE {
+		return entry.Name + "/"
+	}
+	return entry.Name
+}
+
+// addTreeChanges adds an addition or deletion for an entry, recursively for trees
+func (repo Repository) addTreeChanges(changeType ChangeType, entry TreeEntry, entryPath string, changes *[]TreeChange) error {
+	if entry.Kind == TREE_ENTRY_TREE {
+		if changeType == CHANGE_ADDED {
+			return repo.diffTrees(ObjectID{}, entry.Hash, entryPath, changes)
+		}
+		return repo.diffTrees(entry.Hash, ObjectID{}, entryPath, changes)
+	}
+
+	if changeType == CHANGE_ADDED {
+		*changes = append(*changes, TreeChange{Type: CHANGE_ADDED, NewPath: entryPath, NewHash: entry.Hash, NewMode: entry.Mode})
+	} else {
+		*changes = append(*changes, TreeChange{Type: CHANGE_DELETED, OldPath: entryPath, OldHash: entry.Hash, OldMode: entry.Mode})
+	}
+
+	return nil
+}
+
+// contentChunks splits contents in lines, or 64 bytes chunks for long lines, and returns the number of bytes of
+// each distinct chunk, by chunk hash
+func contentChunks(content []byte) map[uint64]int {
+	chunks := make(map[uint64]int)
+
+	for len(content) > 0 {
+		end := 0
+		for end < len(content) && end < 64 {
+			end++
+			if content[end-1] == '\n' {
+				break
+			}
+		}
+
+		hasher := fnv.New64a()
+		hasher.Write(content[:end])
+		chunks[hasher.Sum64()] += end
+
+		content = content[end:]
+	}
+
+	return chunks
+}
+
+// similarity returns the similarity, in percent, of two contents: the number of bytes of the source found in the
+// destination, relative to the largest of both
+func similarity(src, dst map[uint64]int, srcSize, dstSize int) int {
+	if srcSize == 0 && dstSize == 0 {
+		return 100
+	}
+
+	common := 0
+	for chunk, size := range src {
+		common += min(size, dst[chunk])
+	}
+
+	return common * 100 / max(srcSize, dstSize)
+}
+
+type renameSource struct {
+	Path    string
+	Hash    ObjectID
+	Mode    int
+	Deleted bool
+	size    int
+	chunks  map[uint64]int
+}
+
+// detectRenames pairs added files with deleted (renames) or existing (copies) files of similar contents
+func (repo Repository) detectRenames(oldTree ObjectID, changes []TreeChange, options *DiffOptions) ([]TreeChange, error) {
+	threshold := options.RenameThreshold
+	if threshold == 0 {
+		threshold = DEFAULT_RENAME_THRESHOLD
+	}
+
+	sources := make([]*renameSource, 0)
+	destinations := make([]int, 0)
+
+	for n, change := range changes {
+		switch change.Type {
+		case CHANGE_DELETED:
+			sources = append(sources, &renameSource{Path: change.OldPath, Hash: change.OldHash, Mode: change.OldMode, Deleted: true})
+		case CHANGE_MODIFIED:
+			if options.DetectCopies && !options.FindCopiesHarder {
+				sources = append(sources, &renameSource{Path: change.OldPath, Hash: change.OldHash, Mode: change.OldMode})
+			}
+		case CHANGE_ADDED:
+			destinations = append(destinations, n)
+		}
+	}
+
+	// harder: all files of the old tree which were not deleted are copy sources
+	if options.FindCopiesHarder {
+		deleted := make(map[string]bool)
+		for _, source := range sources {
+			deleted[source.Path] = true
+		}
+
+		err := repo.WalkTree(oldTree, func(entryPath string, entry TreeEntry) error {
+			if entry.Kind != TREE_ENTRY_TREE && !deleted[entryPath] {
+				sources = append(sources, &renameSource{Path: entryPath, Hash: entry.Hash, Mode: entry.Mode})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(sources) == 0 || len(destinations) == 0 {
+		return changes, nil
+	}
+
+	type candidate struct {
+		source      *renameSource
+		destination int
+		score       int
+	}
+	candidates := make([]candidate, 0)
+	matched := make(map[int]bool)
+
+	// deleted files are preferred as sources, then files are taken by path, so pairs don't depend on the order
+	// changes were found in
+	sort.SliceStable(sources, func(i, j int) bool {
+		if sources[i].Deleted != sources[j].Deleted {
+			return sources[i].Deleted
+		}
+		return sources[i].Path < sources[j].Path
+	})
+
+	// exact renames first. A deleted file is renamed to one destination, further ones of the same content are
+	// paired with other deleted files if any.
+	exact := make(map[*renameSource]bool)
+	for _, n := range destinations {
+		var best *renameSource
+		for _, source := range sources {
+			if source.Hash != changes[n].NewHash || modeKind(source.Mode) != modeKind(changes[n].NewMode) {
+				continue
+			}
+			if best == nil {
+				best = source
+			}
+			if source.Deleted && !exact[source] {
+				best = source
+				break
+			}
+		}
+
+		if best != nil {
+			candidates = append(candidates, candidate{source: best, destination: n, score: 100})
+			exact[best] = true
+			matched[n] = true
+		}
+	}
+
+	for _, n := range destinations {
+		if matched[n] || modeKind(changes[n].NewMode) != TREE_ENTRY_BLOB {
+			continue
+		}
+
+		dstObject, err := repo.openResolvedObject(changes[n].NewHash)
+		if err != nil {
+			return nil, err
+		}
+		dstChunks := contentChunks(dstObject.Content)
+		dstSize := len(dstObject.Content)
+
+		for _, source := range sources {
+			if modeKind(source.Mode) != TREE_ENTRY_BLOB {
+				continue
+			}
+
+			if source.chunks == nil {
+				srcObject, err := repo.openResolvedObject(source.Hash)
+				if err != nil {
+					return nil, err
+				}
+				source.chunks = contentChunks(srcObject.Content)
+				source.size = len(srcObject.Content)
+			}
+
+			// sizes too different can't reach the threshold
+			if min(source.size, dstSize)*100 < threshold*max(source.size, dstSize) {
+				continue
+			}
+
+			score := similarity(source.chunks, dstChunks, source.size, dstSize)
+			if score >= threshold {
+				candidates = append(candidates, candidate{source: source, destination: n, score: score})
+			}
+		}
+	}
+
+	// best scores first, then deleted sources, then sources by path. Destinations keep the order of changes.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.source.Deleted != b.source.Deleted {
+			return a.source.Deleted
+		}
+		return a.source.Path < b.source.Path
+	})
+
+	// each destination is paired with its best source. A deleted source is renamed once, further destinations
+	// are copies of it.
+	paired := make(map[int]bool)
+	renamed := make(map[*renameSource]bool)
+	removed := make(map[string]bool)
+
+	for _, candidate := range candidates {
+		if paired[candidate.destination] {
+			continue
+		}
+
+		changeType := CHANGE_COPIED
+		if candidate.source.Deleted && !renamed[candidate.source] {
+			changeType = CHANGE_RENAMED
+			renamed[candidate.source] = true
+			removed[candidate.source.Path] = true
+		} else if !options.DetectCopies && !options.FindCopiesHarder {
+			continue
+		}
+
+		paired[candidate.destination] = true
+		change := &changes[candidate.destination]
+		change.Type = changeType
+		change.OldPath = candidate.source.Path
+		change.OldHash = candidate.source.Hash
+		change.OldMode = candidate.source.Mode
+		change.Similarity = candidate.score
+	}
+
+	result := make([]TreeChange, 0, len(changes))
+	for _, change := range changes {
+		if change.Type == CHANGE_DELETED && removed[change.OldPath] {
+			continue
+		}
+		result = append(result, change)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,98 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// lines returns count numbered lines, starting with the given prefix
+func lines(prefix string, count int) string {
+	var content strings.Builder
+	for n := range count {
+		fmt.Fprintf(&content, "%s line %d\n", prefix, n)
+	}
+	return content.String()
+}
+
+var treeDiffs = []struct {
+	name     string
+	old, new map[string]string
+}{
+	{
+		name: "rename over copy",
+		old:  map[string]string{"old.txt": lines("moved", 10), "keep.txt": lines("moved", 10)},
+		new:  map[string]string{"new.txt": lines("moved", 10), "keep.txt": lines("kept", 10)},
+	},
+	{
+		name: "identical renames",
+		old:  map[string]string{"a.txt": lines("same", 10), "b.txt": lines("same", 10)},
+		new:  map[string]string{"c.txt": lines("same", 10), "d.txt": lines("same", 10)},
+	},
+	{
+		name: "directory rename",
+		old:  map[string]string{"dir/x": lines("x", 10), "dir/y": lines("y", 10), "z": lines("z", 5)},
+		new:  map[string]string{"other/x": lines("x", 10), "other/y": lines("y", 10), "z": lines("z", 6)},
+	},
+	{
+		name: "file replaced by a directory",
+		old:  map[string]string{"a": lines("a", 10), "a-b": lines("a-b", 3), "b/c": lines("c", 10)},
+		new:  map[string]string{"a/b": lines("a", 10), "a-b": lines("a-b", 4), "b": lines("b", 10)},
+	},
+	{
+		name: "similar renames",
+		old:  map[string]string{"a.txt": lines("a", 20), "b.txt": lines("a", 18)},
+		new:  map[string]string{"c.txt": lines("a", 19) + "c\n"},
+	},
+	{
+		name: "copies",
+		old:  map[string]string{"src.txt": lines("src", 10), "orig.txt": lines("orig", 10)},
+		new:  map[string]string{"src.txt": lines("src", 11), "orig.txt": lines("orig", 10), "copy.txt": lines("src", 10), "copy2.txt": lines("orig", 10)},
+	},
+}
+
+var treeDiffOptions = []struct {
+	options *DiffOptions
+	args    []string // git diff options
+}{
+	{&DiffOptions{}, []string{"--no-renames"}},
+	{&DiffOptions{DetectRenames: true}, []string{"-M"}},
+	{&DiffOptions{DetectRenames: true, DetectCopies: true}, []string{"-C"}},
+	{&DiffOptions{DetectRenames: true, DetectCopies: true, FindCopiesHarder: true}, []string{"-C", "-C"}},
+}
+
+func TestDiffTrees(t *testing.T) {
+	for _, diff := range treeDiffs {
+		repo := newTestRepo(t)
+		oldTree, newTree := repo.tree(diff.old), repo.tree(diff.new)
+		repository := repo.open(false)
+
+		for _, options := range treeDiffOptions {
+			oldHash, _ := ParseObjectID(oldTree)
+			newHash, _ := ParseObjectID(newTree)
+
+			changes, err := repository.DiffTrees(oldHash, newHash, options.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, 0, len(changes))
+			for _, change := range changes {
+				switch change.Type {
+				case CHANGE_RENAMED, CHANGE_COPIED:
+					got = append(got, fmt.Sprintf("%c%03d\t%s\t%s", change.Type, change.Similarity, change.OldPath, change.NewPath))
+				default:
+					got = append(got, fmt.Sprintf("%c\t%s", change.Type, change.Path()))
+				}
+			}
+
+			args := append([]string{"diff", "--name-status"}, options.args...)
+			expected := repo.git(nil, append(args, oldTree, newTree)...)
+
+			if strings.Join(got, "\n") != expected {
+				t.Errorf("%s: diff %s:\n%s\nexpected:\n%s", diff.name, strings.Join(options.args, " "),
+					strings.Join(got, "\n"), expected)
+			}
+		}
+	}
+}
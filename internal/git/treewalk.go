@@ -0,0 +1,121 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// TreeWalkFunc is called by WalkTree for each entry, with its path from the walked tree
+type TreeWalkFunc func(entryPath string, entry TreeEntry) error
+
+var (
+	// SkipTree can be returned by a TreeWalkFunc for a tree entry, so its content is not walked through
+	SkipTree = errors.New("skip this tree")
+
+	// ErrPathNotFound is returned when a path does not exist in a tree
+	ErrPathNotFound = errors.New("path not found")
+)
+
+// readTreeEntries opens a tree and returns its entries, in the order they are stored: by name, tree names being
+// followed by a slash. The null hash is an empty tree.
+func (repo Repository) readTreeEntries(hash ObjectID) ([]TreeEntry, error) {
+	entries := make([]TreeEntry, 0)
+
+	if hash.IsZero() {
+		return entries, nil
+	}
+
+	object, err := repo.openResolvedObject(hash)
+	if err != nil {
+		return entries, err
+	}
+	if object.Type != OBJECT_TYPE_TREE {
+		return entries, fmt.Errorf("object %s is a %s, not a tree", hash, object.Type)
+	}
+
+	tree, err := repo.ConvertTree(object.Content)
+	if err != nil {
+		return entries, err
+	}
+
+	return tree.Entries, nil
+}
+
+// readTreeEntriesByName opens a tree and returns its entries by name
+func (repo Repository) readTreeEntriesByName(hash ObjectID) (map[string]TreeEntry, error) {
+	entries, err := repo.readTreeEntries(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]TreeEntry, len(entries))
+	for _, entry := range entries {
+		byName[entry.Name] = entry
+	}
+
+	return byName, nil
+}
+
+// WalkTree calls fn for every entry of a tree, recursively, in git's order. Sub trees are walked through right
+// after fn is called for them, unless it returns SkipTree. Any other error stops the walk and is returned.
+func (repo Repository) WalkTree(treeHash ObjectID, fn TreeWalkFunc) error {
+	return repo.walkTree(treeHash, "", fn)
+}
+
+func (repo Repository) walkTree(treeHash ObjectID, prefix string, fn TreeWalkFunc) error {
+	entries, err := repo.readTreeEntries(treeHash)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryPath := path.Join(prefix, entry.Name)
+
+		err := fn(entryPath, entry)
+		if err == SkipTree {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if entry.Kind == TREE_ENTRY_TREE {
+			if err := repo.walkTree(entry.Hash, entryPath, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// LookupPath returns the entry at the given slash separated path, starting from a tree. An empty path is the tree
+// itself, returned as an entry without name.
+func (repo Repository) LookupPath(treeHash ObjectID, entryPath string) (TreeEntry, error) {
+	entry := TreeEntry{Hash: treeHash, Mode: OBJ_TYPE_TREE, Kind: TREE_ENTRY_TREE}
+
+	for _, name := range strings.Split(entryPath, "/") {
+		if name == "" {
+			continue
+		}
+
+		if entry.Kind != TREE_ENTRY_TREE {
+			return TreeEntry{}, fmt.Errorf("%w: %s", ErrPathNotFound, entryPath)
+		}
+
+		entries, err := repo.readTreeEntriesByName(entry.Hash)
+		if err != nil {
+			return TreeEntry{}, err
+		}
+
+		found, ok := entries[name]
+		if !ok {
+			return TreeEntry{}, fmt.Errorf("%w: %s", ErrPathNotFound, entryPath)
+		}
+		entry = found
+	}
+
+	return entry, nil
+}
@@ -1,17 +1,23 @@
 package git
 
 import (
-	"bufio"
+	"fmt"
+	"io"
 )
 
-func ReadVariantInteger(reader *bufio.Reader, offset bool) int64 {
+// ReadVariantInteger reads a big endian variable length integer, as used for offset deltas if offset is set
+func ReadVariantInteger(reader io.ByteReader, offset bool) (int64, error) {
 	var b byte
 	var err error
 	val := int64(0)
 
 	for {
 		if b, err = reader.ReadByte(); err != nil {
-			panic(err)
+			return 0, err
+		}
+
+		if val > 1<<55 {
+			return 0, fmt.Errorf("variable length integer overflow")
 		}
 
 		val = (val << 7) | int64(b&0x7f)
@@ -24,10 +30,11 @@ func ReadVariantInteger(reader *bufio.Reader, offset bool) int64 {
 		}
 	}
 
-	return val
+	return val, nil
 }
 
-func ReadVariantIntegerLE(reader *bufio.Reader) int64 {
+// ReadVariantIntegerLE reads a little endian variable length integer, as used in delta headers
+func ReadVariantIntegerLE(reader io.ByteReader) (int64, error) {
 	var b byte
 	var err error
 	val := int64(0)
@@ -35,7 +42,11 @@ func ReadVariantIntegerLE(reader *bufio.Reader) int64 {
 
 	for {
 		if b, err = reader.ReadByte(); err != nil {
-			panic(err)
+			return 0, err
+		}
+
+		if bshift > 56 {
+			return 0, fmt.Errorf("variable length integer overflow")
 		}
 
 		val |= int64(b&0x7f) << bshift
@@ -46,5 +57,5 @@ func ReadVariantIntegerLE(reader *bufio.Reader) int64 {
 		bshift += 7
 	}
 
-	return val
+	return val, nil
 }
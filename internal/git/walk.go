@@ -0,0 +1,503 @@
+package git
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+type RevWalkSort int
+
+const (
+	REVWALK_SORT_DATE      RevWalkSort = iota // most recent committer date first
+	REVWALK_SORT_TOPO                         // no parent before all its children, without intermixing lines of history
+	REVWALK_SORT_TOPO_DATE                    // no parent before all its children, otherwise most recent committer date first
+)
+
+const (
+	// number of commits still walked once only uninteresting ones are queued, to cope with clock skew, like git
+	REVWALK_SLOP = 5
+)
+
+type queuedCommit struct {
+	commit *Commit
+	seq    int
+}
+
+// commitQueue is a priority queue of commits, most recent committer date first. Commits with the same date are
+// returned in insertion order. If generation is set, commits with a higher generation number come first.
+type commitQueue struct {
+	entries    []queuedCommit
+	counter    int
+	generation bool
+}
+
+func (q *commitQueue) Len() int { return len(q.entries) }
+func (q *commitQueue) Less(i, j int) bool {
+	if q.generation && q.entries[i].commit.Generation != 0 && q.entries[j].commit.Generation != 0 &&
+		q.entries[i].commit.Generation != q.entries[j].commit.Generation {
+		return q.entries[i].commit.Generation > q.entries[j].commit.Generation
+	}
+	if !q.entries[i].commit.Committer.When.Equal(q.entries[j].commit.Committer.When) {
+		return q.entries[i].commit.Committer.When.After(q.entries[j].commit.Committer.When)
+	}
+	return q.entries[i].seq < q.entries[j].seq
+}
+func (q *commitQueue) Swap(i, j int) { q.entries[i], q.entries[j] = q.entries[j], q.entries[i] }
+func (q *commitQueue) Push(x any)    { q.entries = append(q.entries, x.(queuedCommit)) }
+func (q *commitQueue) Pop() any {
+	entry := q.entries[len(q.entries)-1]
+	q.entries = q.entries[:len(q.entries)-1]
+	return entry
+}
+
+func (q *commitQueue) PushCommit(commit *Commit) {
+	heap.Push(q, queuedCommit{commit: commit, seq: q.counter})
+	q.counter++
+}
+
+func (q *commitQueue) PopCommit() *Commit {
+	return heap.Pop(q).(queuedCommit).commit
+}
+
+// RevWalk walks the history from a set of commits, excluding the ones reachable from another set, as
+// git rev-list does. Options must be set before the first call to Next.
+type RevWalk struct {
+	repo Repository
+
+	Sort        RevWalkSort
+	Reverse     bool
+	FirstParent bool
+	MaxCount    int       // 0 for no limit
+	Since       time.Time // commits older than Since are neither returned nor walked through; zero for no limit
+	Until       time.Time // commits newer than Until are not returned; zero for no limit
+
+	// Commits are read from the commit-graph when possible. Unless AllowPartial is set, returned ones are then
+	// fully opened.
+	AllowPartial bool
+
+	includes []ObjectID
+	excludes []ObjectID
+
+	started       bool
+	queue         *commitQueue
+	seen          map[ObjectID]*Commit // queued commits, by hash
+	uninteresting map[ObjectID]bool
+	sorted        []*Commit // whole result, when it can't be streamed
+	returned      int
+}
+
+func (repo Repository) NewRevWalk() *RevWalk {
+	return &RevWalk{
+		repo:          repo,
+		includes:      make([]ObjectID, 0),
+		excludes:      make([]ObjectID, 0),
+		queue:         &commitQueue{},
+		seen:          make(map[ObjectID]*Commit),
+		uninteresting: make(map[ObjectID]bool),
+	}
+}
+
+// Push adds a revision to start walking from. "A..B" walks from B excluding commits reachable from A, and "^A"
+// excludes commits reachable from A.
+func (walk *RevWalk) Push(rev string) error {
+	if strings.Contains(rev, "...") {
+		return fmt.Errorf("symmetric difference is not supported: %s", rev)
+	}
+
+	if from, to, ok := strings.Cut(rev, ".."); ok {
+		if from == "" {
+			from = "HEAD"
+		}
+		if to == "" {
+			to = "HEAD"
+		}
+
+		if err := walk.Hide(from); err != nil {
+			return err
+		}
+		return walk.Push(to)
+	}
+
+	if excluded, ok := strings.CutPrefix(rev, "^"); ok {
+		return walk.Hide(excluded)
+	}
+
+	hash, err := walk.resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+	walk.includes = append(walk.includes, hash)
+
+	return nil
+}
+
+// Hide excludes commits reachable from the given revision
+func (walk *RevWalk) Hide(rev string) error {
+	hash, err := walk.resolveCommit(rev)
+	if err != nil {
+		return err
+	}
+	walk.excludes = append(walk.excludes, hash)
+
+	return nil
+}
+
+func (walk *RevWalk) resolveCommit(rev string) (ObjectID, error) {
+	if walk.started {
+		return ObjectID{}, fmt.Errorf("revisions can't be added once the walk started")
+	}
+
+	hash, err := walk.repo.ResolveRevision(rev)
+	if err != nil {
+		return ObjectID{}, err
+	}
+
+	return walk.repo.peelToType(hash, OBJECT_TYPE_COMMIT)
+}
+
+// enqueue opens a commit and queues it, unless it was already seen
+func (walk *RevWalk) enqueue(hash ObjectID) error {
+	if _, ok := walk.seen[hash]; ok {
+		return nil
+	}
+
+	commit, err := walk.repo.openGraphCommit(hash)
+	if err != nil {
+		return err
+	}
+	walk.seen[hash] = commit
+	walk.queue.PushCommit(commit)
+
+	return nil
+}
+
+// markUninteresting marks a commit as uninteresting, along with its ancestors which were already walked through:
+// because of clock skew, they may have been walked before the commit, as they were reachable from an interesting
+// one. Other ancestors are marked once the commit is popped.
+func (walk *RevWalk) markUninteresting(hash ObjectID) {
+	pending := []ObjectID{hash}
+
+	for len(pending) > 0 {
+		hash := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+
+		if walk.uninteresting[hash] {
+			continue
+		}
+		walk.uninteresting[hash] = true
+
+		if commit, ok := walk.seen[hash]; ok {
+			pending = append(pending, commit.Parents...)
+		}
+	}
+}
+
+func (walk *RevWalk) parents(commit *Commit) []ObjectID {
+	if walk.FirstParent && len(commit.Parents) > 1 {
+		return commit.Parents[:1]
+	}
+	return commit.Parents
+}
+
+// step pops the next commit from the queue and queues its parents. It returns the commit if it is interesting and
+// should be walked through, nil otherwise.
+func (walk *RevWalk) step() (*Commit, error) {
+	commit := walk.queue.PopCommit()
+
+	if walk.uninteresting[commit.Hash] {
+		for _, parent := range commit.Parents {
+			walk.markUninteresting(parent)
+			if err := walk.enqueue(parent); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	if !walk.Since.IsZero() && commit.Committer.When.Before(walk.Since) {
+		return nil, nil
+	}
+
+	for _, parent := range walk.parents(commit) {
+		if err := walk.enqueue(parent); err != nil {
+			return nil, err
+		}
+	}
+
+	return commit, nil
+}
+
+func (walk *RevWalk) isReturned(commit *Commit) bool {
+	return walk.Until.IsZero() || !commit.Committer.When.After(walk.Until)
+}
+
+func (walk *RevWalk) everybodyUninteresting() bool {
+	for _, entry := range walk.queue.entries {
+		if !walk.uninteresting[entry.commit.Hash] {
+			return false
+		}
+	}
+	return true
+}
+
+func (walk *RevWalk) start() error {
+	walk.started = true
+
+	// Without exclusions, in date order, commits are returned as they are walked; otherwise the whole history
+	// to return is computed first.
+	limited := len(walk.excludes) > 0 || walk.Sort != REVWALK_SORT_DATE || walk.Reverse
+
+	// Walking by generation number, no commit is walked before its descendants, so it can't be found uninteresting
+	// after it was walked through, whatever the commit dates are. The result is sorted by date afterwards.
+	walk.queue.generation = limited && walk.repo.CommitGraph != nil
+
+	for _, hash := range walk.excludes {
+		walk.markUninteresting(hash)
+		if err := walk.enqueue(hash); err != nil {
+			return err
+		}
+	}
+
+	for _, hash := range walk.includes {
+		if err := walk.enqueue(hash); err != nil {
+			return err
+		}
+	}
+
+	if !limited {
+		return nil
+	}
+
+	return walk.limit()
+}
+
+// limit walks the whole history, removes uninteresting commits and sorts the result
+func (walk *RevWalk) limit() error {
+	commits := make([]*Commit, 0)
+	slop := REVWALK_SLOP
+
+	for walk.queue.Len() > 0 {
+		commit, err := walk.step()
+		if err != nil {
+			return err
+		}
+
+		if commit != nil {
+			commits = append(commits, commit)
+		}
+
+		if walk.everybodyUninteresting() {
+			if slop--; slop == 0 {
+				break
+			}
+		} else {
+			slop = REVWALK_SLOP
+		}
+	}
+
+	// a commit can be marked uninteresting after it was walked through, because of clock skew
+	interesting := make([]*Commit, 0, len(commits))
+	for _, commit := range commits {
+		if !walk.uninteresting[commit.Hash] {
+			interesting = append(interesting, commit)
+		}
+	}
+
+	if walk.queue.generation {
+		interesting = walk.dateOrder(interesting)
+	}
+
+	walk.sorted = make([]*Commit, 0, len(interesting))
+	for _, commit := range interesting {
+		if walk.isReturned(commit) {
+			walk.sorted = append(walk.sorted, commit)
+		}
+	}
+
+	if walk.Sort == REVWALK_SORT_TOPO || walk.Sort == REVWALK_SORT_TOPO_DATE {
+		walk.sorted = walk.topoSort(walk.sorted)
+	}
+
+	if walk.MaxCount > 0 && len(walk.sorted) > walk.MaxCount {
+		walk.sorted = walk.sorted[:walk.MaxCount]
+	}
+
+	if walk.Reverse {
+		slices.Reverse(walk.sorted)
+	}
+
+	return nil
+}
+
+// dateOrder sorts commits in the order a walk by date from the pushed commits returns them
+func (walk *RevWalk) dateOrder(commits []*Commit) []*Commit {
+	byHash := make(map[ObjectID]*Commit)
+	for _, commit := range commits {
+		byHash[commit.Hash] = commit
+	}
+
+	queue := &commitQueue{}
+	queued := make(map[ObjectID]bool)
+	push := func(hash ObjectID) {
+		if commit, ok := byHash[hash]; ok && !queued[hash] {
+			queued[hash] = true
+			queue.PushCommit(commit)
+		}
+	}
+
+	for _, hash := range walk.includes {
+		push(hash)
+	}
+
+	sorted := make([]*Commit, 0, len(commits))
+	for queue.Len() > 0 {
+		commit := queue.PopCommit()
+		sorted = append(sorted, commit)
+
+		for _, parent := range walk.parents(commit) {
+			push(parent)
+		}
+	}
+
+	return sorted
+}
+
+// topoSort sorts commits, given in date order, so that children are all before their parents. Once a commit is
+// returned, the line of its last parent is followed as long as possible, like git does. With REVWALK_SORT_TOPO_DATE,
+// the most recent commit whose children were all returned comes next instead.
+func (walk *RevWalk) topoSort(commits []*Commit) []*Commit {
+	indegree := make(map[ObjectID]int)
+	for _, commit := range commits {
+		indegree[commit.Hash] = 0
+	}
+	for _, commit := range commits {
+		for _, parent := range walk.parents(commit) {
+			if _, ok := indegree[parent]; ok {
+				indegree[parent]++
+			}
+		}
+	}
+
+	byHash := make(map[ObjectID]*Commit)
+	for _, commit := range commits {
+		byHash[commit.Hash] = commit
+	}
+
+	// commits whose children were all returned
+	ready := &commitQueue{}
+	stack := make([]*Commit, 0)
+	push := func(commit *Commit) {
+		if walk.Sort == REVWALK_SORT_TOPO_DATE {
+			ready.PushCommit(commit)
+		} else {
+			stack = append(stack, commit)
+		}
+	}
+	pop := func() *Commit {
+		if walk.Sort == REVWALK_SORT_TOPO_DATE {
+			return ready.PopCommit()
+		}
+		commit := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		return commit
+	}
+
+	// the stack returns the first commits first
+	if walk.Sort == REVWALK_SORT_TOPO_DATE {
+		for _, commit := range commits {
+			if indegree[commit.Hash] == 0 {
+				push(commit)
+			}
+		}
+	} else {
+		for n := len(commits) - 1; n >= 0; n-- {
+			if indegree[commits[n].Hash] == 0 {
+				push(commits[n])
+			}
+		}
+	}
+
+	sorted := make([]*Commit, 0, len(commits))
+	for ready.Len() > 0 || len(stack) > 0 {
+		commit := pop()
+		sorted = append(sorted, commit)
+
+		for _, parent := range walk.parents(commit) {
+			if _, ok := indegree[parent]; !ok {
+				continue
+			}
+
+			indegree[parent]--
+			if indegree[parent] == 0 {
+				push(byHash[parent])
+			}
+		}
+	}
+
+	return sorted
+}
+
+// Next returns the next commit of the walk, or io.EOF once done
+func (walk *RevWalk) Next() (*Commit, error) {
+	commit, err := walk.next()
+	if err != nil || !commit.Partial || walk.AllowPartial {
+		return commit, err
+	}
+
+	return walk.repo.OpenCommit(commit.Hash)
+}
+
+func (walk *RevWalk) next() (*Commit, error) {
+	if !walk.started {
+		if err := walk.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	if walk.sorted != nil {
+		if walk.returned >= len(walk.sorted) {
+			return nil, io.EOF
+		}
+		walk.returned++
+		return walk.sorted[walk.returned-1], nil
+	}
+
+	for walk.queue.Len() > 0 {
+		if walk.MaxCount > 0 && walk.returned >= walk.MaxCount {
+			break
+		}
+
+		commit, err := walk.step()
+		if err != nil {
+			return nil, err
+		}
+
+		if commit != nil && walk.isReturned(commit) {
+			walk.returned++
+			return commit, nil
+		}
+	}
+
+	return nil, io.EOF
+}
+
+// Commits returns all the remaining commits of the walk
+func (walk *RevWalk) Commits() ([]*Commit, error) {
+	commits := make([]*Commit, 0)
+
+	for {
+		commit, err := walk.Next()
+		if err == io.EOF {
+			return commits, nil
+		}
+		if err != nil {
+			return commits, err
+		}
+
+		commits = append(commits, commit)
+	}
+}
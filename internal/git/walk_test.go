@@ -0,0 +1,156 @@
+package git
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// walkHistories builds histories where commit dates don't follow the graph
+var walkHistories = []struct {
+	name  string
+	build func(repo *testRepo)
+	revs  [][]string
+
+	// results expected with a commit-graph, where git's are wrong because the skew is larger than its slop
+	exact map[string][]string
+}{
+	{
+		name: "equal dates",
+		build: func(repo *testRepo) {
+			repo.commit("a", 1000)
+			repo.commit("b", 1000, "a")
+			repo.commit("c", 1000, "b")
+			repo.commit("d", 1000, "c")
+			repo.commit("feat", 1000, "b")
+			repo.commit("main", 1000, "d")
+			repo.commit("merge", 1000, "main", "feat")
+		},
+		revs: [][]string{
+			{"main..feat"},
+			{"feat..main"},
+			{"merge..b"},
+			{"b..merge"},
+			{"^feat", "^c", "merge"},
+		},
+	},
+	{
+		name: "clock skew",
+		build: func(repo *testRepo) {
+			// the hidden side is older than the ancestors it shares with the shown side
+			repo.commit("a", 5000)
+			repo.commit("b", 6000, "a")
+			repo.commit("c", 7000, "b")
+			repo.commit("d", 1000, "c")
+			repo.commit("e", 1001, "d")
+			repo.commit("x", 9000, "c")
+			repo.commit("y", 9001, "x")
+		},
+		revs: [][]string{
+			{"e..y"},
+			{"y..e"},
+			{"d..y"},
+			{"^e", "^x", "y"},
+		},
+	},
+	{
+		name: "deep clock skew",
+		build: func(repo *testRepo) {
+			// more commits than the walk's slop are dated before their shared ancestor
+			repo.commit("a", 5000)
+			repo.commit("b", 6000, "a")
+			repo.commit("h0", 100, "b")
+			for n := 1; n < 10; n++ {
+				repo.commit("h"+strconv.Itoa(n), int64(100+n), "h"+strconv.Itoa(n-1))
+			}
+			repo.commit("x", 9000, "b")
+		},
+		revs: [][]string{
+			{"h9..x"},
+			{"x..h9"},
+		},
+		exact: map[string][]string{
+			"h9..x": {"x"},
+		},
+	},
+	{
+		name: "skewed merge",
+		build: func(repo *testRepo) {
+			repo.commit("a", 1000)
+			repo.commit("b", 1010, "a")
+			repo.commit("c", 1020, "b")
+			repo.commit("side", 1005, "a")
+			repo.commit("m", 1001, "c", "side")
+			repo.commit("n", 1030, "m")
+			repo.commit("topic", 2000, "c")
+		},
+		revs: [][]string{
+			{"n", "topic"},
+			{"n..topic"},
+			{"topic..n"},
+			{"side..n"},
+			{"b..m"},
+		},
+	},
+}
+
+var walkOrders = []struct {
+	sort RevWalkSort
+	args []string // git rev-list options
+}{
+	{REVWALK_SORT_DATE, nil},
+	{REVWALK_SORT_TOPO, []string{"--topo-order"}},
+	{REVWALK_SORT_TOPO_DATE, []string{"--date-order"}},
+}
+
+func TestRevWalk(t *testing.T) {
+	for _, history := range walkHistories {
+		for _, withGraph := range []bool{false, true} {
+			repo := newTestRepo(t)
+			history.build(repo)
+			repository := repo.open(withGraph)
+
+			for _, revs := range history.revs {
+				for _, order := range walkOrders {
+					walk := repository.NewRevWalk()
+					walk.Sort = order.sort
+					args := append([]string{"rev-list"}, order.args...)
+
+					for _, rev := range revs {
+						if err := walk.Push(rev); err != nil {
+							t.Fatal(err)
+						}
+					}
+
+					commits, err := walk.Commits()
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					hashes := make([]ObjectID, 0, len(commits))
+					for _, commit := range commits {
+						hashes = append(hashes, commit.Hash)
+					}
+
+					expected := make([]string, 0)
+					if out := repo.git(nil, append(args, revs...)...); out != "" {
+						for _, hash := range strings.Split(out, "\n") {
+							id, _ := ParseObjectID(hash)
+							expected = append(expected, repo.names([]ObjectID{id})...)
+						}
+					}
+
+					if exact, ok := history.exact[strings.Join(revs, " ")]; ok && withGraph {
+						expected = exact
+					}
+
+					if got := repo.names(hashes); !slices.Equal(got, expected) {
+						t.Errorf("%s (graph: %v): rev-list %s %s = %v, expected %v", history.name, withGraph,
+							strings.Join(order.args, " "), strings.Join(revs, " "), got, expected)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mycroft/git-reader/internal/git"
+)
+
+var relativeDateRe = regexp.MustCompile(`^(\d+)[. ](second|minute|hour|day|week|month|year)s?[. ]ago$`)
+
+// parseDate parses --since/--until values: unix timestamps, "2006-01-02", RFC 3339 dates or "N <unit>s ago"
+func parseDate(value string) (time.Time, error) {
+	if timestamp, err := strconv.ParseInt(strings.TrimPrefix(value, "@"), 10, 64); err == nil {
+		return time.Unix(timestamp, 0), nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+
+	if matches := relativeDateRe.FindStringSubmatch(value); matches != nil {
+		count, _ := strconv.Atoi(matches[1])
+		now := time.Now()
+
+		switch matches[2] {
+		case "second":
+			return now.Add(-time.Duration(count) * time.Second), nil
+		case "minute":
+			return now.Add(-time.Duration(count) * time.Minute), nil
+		case "hour":
+			return now.Add(-time.Duration(count) * time.Hour), nil
+		case "day":
+			return now.AddDate(0, 0, -count), nil
+		case "week":
+			return now.AddDate(0, 0, -7*count), nil
+		case "month":
+			return now.AddDate(0, -count, 0), nil
+		case "year":
+			return now.AddDate(-count, 0, 0), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date: %s", value)
+}
+
+// printCommit prints a commit in the given format: "hash", "oneline" or "full"
+func printCommit(commit *git.Commit, format string) {
+	switch format {
+	case "hash":
+		fmt.Println(commit.Hash)
+
+	case "oneline":
+		fmt.Printf("%s %s\n", commit.Hash.String()[:7], commit.Title())
+
+	default:
+		fmt.Printf("commit %s\n", commit.Hash)
+		if len(commit.Parents) > 1 {
+			parents := make([]string, 0, len(commit.Parents))
+			for _, parent := range commit.Parents {
+				parents = append(parents, parent.String()[:7])
+			}
+			fmt.Printf("Merge: %s\n", strings.Join(parents, " "))
+		}
+		fmt.Printf("Author: %s <%s>\n", commit.Author.Name, commit.Author.Email)
+		fmt.Printf("Date:   %s\n", commit.Author.When.Format("Mon Jan 2 15:04:05 2006 -0700"))
+		fmt.Println()
+		for _, line := range strings.Split(strings.TrimRight(commit.Message, "\n"), "\n") {
+			if line == "" {
+				fmt.Println()
+			} else {
+				fmt.Printf("    %s\n", line)
+			}
+		}
+	}
+}
+
+// runRevWalk parses the history walking options shared by log & rev-list, then prints the walked commits
+func runRevWalk(repository git.Repository, name string, defaultFormat string, args []string) error {
+	var maxCount int
+	var since, until, format string
+	var oneline, reverse, topoOrder, dateOrder, firstParent bool
+
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.IntVar(&maxCount, "n", 0, "Limit the number of commits to output")
+	flags.IntVar(&maxCount, "max-count", 0, "Limit the number of commits to output")
+	flags.StringVar(&since, "since", "", "Show commits more recent than a date")
+	flags.StringVar(&until, "until", "", "Show commits older than a date")
+	flags.StringVar(&format, "format", defaultFormat, "Output format: hash, oneline or full")
+	flags.BoolVar(&oneline, "oneline", false, "Shorthand for -format oneline")
+	flags.BoolVar(&reverse, "reverse", false, "Output commits in reverse order")
+	flags.BoolVar(&topoOrder, "topo-order", false, "Show no parents before all of its children")
+	flags.BoolVar(&dateOrder, "date-order", false, "Show commits in commit timestamp order, but no parents before all of its children")
+	flags.BoolVar(&firstParent, "first-parent", false, "Follow only the first parent of merge commits")
+	revs := parseArgs(flags, args)
+
+	walk := repository.NewRevWalk()
+	walk.MaxCount = maxCount
+	walk.Reverse = reverse
+	walk.FirstParent = firstParent
+
+	if dateOrder {
+		walk.Sort = git.REVWALK_SORT_TOPO_DATE
+	} else if topoOrder {
+		walk.Sort = git.REVWALK_SORT_TOPO
+	}
+
+	if oneline {
+		format = "oneline"
+	}
+
+	// hashes are all that is needed from commits read from the commit-graph
+	walk.AllowPartial = format == "hash"
+
+	var err error
+	if since != "" {
+		if walk.Since, err = parseDate(since); err != nil {
+			return err
+		}
+	}
+	if until != "" {
+		if walk.Until, err = parseDate(until); err != nil {
+			return err
+		}
+	}
+
+	if len(revs) == 0 {
+		revs = []string{"HEAD"}
+	}
+
+	for _, rev := range revs {
+		if err := walk.Push(rev); err != nil {
+			return err
+		}
+	}
+
+	for n := 0; ; n++ {
+		commit, err := walk.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if n > 0 && format == "full" {
+			fmt.Println()
+		}
+		printCommit(commit, format)
+	}
+}
+
+func runLog(repository git.Repository, args []string) error {
+	return runRevWalk(repository, "log", "full", args)
+}
+
+func runRevList(repository git.Repository, args []string) error {
+	return runRevWalk(repository, "rev-list", "hash", args)
+}
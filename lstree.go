@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mycroft/git-reader/internal/git"
+)
+
+// pathMatcher tells whether entries are shown or walked through, given the paths to list. As with git ls-tree, a
+// path shows the entry itself, or the entries in it if it ends with a slash.
+type pathMatcher []string
+
+// match returns true if the entry at entryPath is listed, and false with descend set if the entry is a tree
+// containing listed entries
+func (paths pathMatcher) match(entryPath string) (bool, bool) {
+	if len(paths) == 0 {
+		return true, false
+	}
+
+	listed, descend := false, false
+
+	for _, p := range paths {
+		trimmed := strings.TrimSuffix(p, "/")
+
+		switch {
+		case trimmed == "" || strings.HasPrefix(entryPath, trimmed+"/"):
+			listed = true
+		case entryPath == trimmed && p == trimmed:
+			listed = true
+		case strings.HasPrefix(trimmed+"/", entryPath+"/"):
+			descend = true
+		}
+	}
+
+	return listed, descend
+}
+
+func runLsTree(repository git.Repository, args []string) error {
+	var recursive, long, nameOnly bool
+
+	flags := flag.NewFlagSet("ls-tree", flag.ExitOnError)
+	flags.BoolVar(&recursive, "r", false, "Recurse into sub trees")
+	flags.BoolVar(&long, "l", false, "Show the size of blobs")
+	flags.BoolVar(&long, "long", false, "Show the size of blobs")
+	flags.BoolVar(&nameOnly, "name-only", false, "Show only the paths of entries")
+	revs := parseArgs(flags, args)
+
+	if len(revs) < 1 {
+		return fmt.Errorf("usage: ls-tree [-r] [-l] [-name-only] <rev> [<path>...]")
+	}
+
+	treeHash, err := resolveTree(repository, revs[0])
+	if err != nil {
+		return err
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+
+	paths := pathMatcher(revs[1:])
+
+	return repository.WalkTree(treeHash, func(entryPath string, entry git.TreeEntry) error {
+		listed, descend := paths.match(entryPath)
+
+		isTree := entry.Kind == git.TREE_ENTRY_TREE
+		if !listed {
+			if descend && isTree {
+				return nil
+			}
+			return git.SkipTree
+		}
+
+		// when recursing, trees are walked through instead of being shown
+		if recursive && isTree {
+			return nil
+		}
+
+		if nameOnly {
+			fmt.Fprintln(out, git.QuotePath(entryPath))
+		} else if long {
+			size := "-"
+			if entry.ObjectType() == git.OBJECT_TYPE_BLOB {
+				header, reader, err := repository.OpenObjectReader(entry.Hash)
+				if err != nil {
+					return err
+				}
+				reader.Close()
+				size = fmt.Sprint(header.Size)
+			}
+			fmt.Fprintf(out, "%06d %s %s %7s\t%s\n", entry.Mode, entry.ObjectType(), entry.Hash, size, git.QuotePath(entryPath))
+		} else {
+			fmt.Fprintf(out, "%06d %s %s\t%s\n", entry.Mode, entry.ObjectType(), entry.Hash, git.QuotePath(entryPath))
+		}
+
+		return git.SkipTree
+	})
+}
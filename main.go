@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 
@@ -15,11 +16,60 @@ var (
 	verbose        bool
 	current        bool
 	printReference bool
+	listRefs       bool
 )
 
+// commands are run when their name is given as first argument, with the remaining arguments
+var commands = map[string]func(git.Repository, []string) error{
+	"log":          runLog,
+	"rev-list":     runRevList,
+	"merge-base":   runMergeBase,
+	"ahead-behind": runAheadBehind,
+	"diff":         runDiff,
+	"show":         runShow,
+	"ls-tree":      runLsTree,
+	"blame":        runBlame,
+}
+
+// parseArgs parses a command's options, which can be given before or after its arguments, and returns the arguments
+func parseArgs(flags *flag.FlagSet, args []string) []string {
+	positional := make([]string, 0)
+
+	for {
+		flags.Parse(args)
+		consumed := len(args) - flags.NArg()
+
+		// "--" ends options: all remaining arguments are positional
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, flags.Args()...)
+		}
+
+		args = flags.Args()
+		if len(args) == 0 {
+			return positional
+		}
+
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// printDeltaBaseCacheStats prints how often delta bases were found in the cache
+func printDeltaBaseCacheStats(repository git.Repository) {
+	cache := repository.DeltaBaseCache
+	if cache == nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "delta base cache: %d hits, %d misses, %d objects, %d bytes\n",
+		cache.Hits.Load(), cache.Misses.Load(), cache.Len(), cache.Size())
+}
+
+// check logs an error and exits, if any
 func check(err error) {
 	if err != nil {
-		panic(err)
+		log.Println(err)
+		os.Exit(1)
 	}
 }
 
@@ -29,11 +79,12 @@ func init() {
 		panic(err)
 	}
 	flag.StringVar(&repositoryFlag, "repository", cwd, "Repository path")
-	flag.StringVar(&reference, "ref", "", "Object reference to dump")
+	flag.StringVar(&reference, "ref", "", "Object reference to dump (hash, branch, HEAD~3:path/to/file...)")
 
 	flag.BoolVar(&verbose, "verbose", false, "Verbose mode")
 	flag.BoolVar(&current, "current", false, "Parse current ref")
 	flag.BoolVar(&printReference, "print-ref", false, "Print ref on stderr")
+	flag.BoolVar(&listRefs, "refs", false, "List references")
 }
 
 func main() {
@@ -50,16 +101,43 @@ func main() {
 		log.Println(err)
 		os.Exit(1)
 	}
+	defer repository.Close()
+
+	if verbose {
+		defer printDeltaBaseCacheStats(repository)
+	}
+
+	if listRefs {
+		refs, err := repository.ListRefs()
+		check(err)
+
+		for _, ref := range refs {
+			fmt.Printf("%s %s\n", ref.Hash, ref.Name)
+		}
+		return
+	}
+
+	if flag.NArg() > 0 {
+		if command, ok := commands[flag.Arg(0)]; ok {
+			if err := command(repository, flag.Args()[1:]); err != nil {
+				log.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
 
 	if flag.NArg() > 0 && reference == "" {
 		reference = os.Args[len(os.Args)-1]
 	}
 
 	if current {
-		reference, err = repository.GetCurrentRef()
+		hash, err := repository.GetCurrentRef()
 		if err != nil {
-			panic(err)
+			log.Println(err)
+			os.Exit(1)
 		}
+		reference = hash.String()
 	}
 
 	if printReference {
@@ -67,33 +145,54 @@ func main() {
 	}
 
 	if reference == "" {
-		for _, object := range repository.Objects {
-			if verbose {
-				o, err := repository.OpenObject(object.Hash)
-				if err != nil {
-					fmt.Println(object.Hash)
-					panic(err)
-				}
-
-				fmt.Printf("%s %s %d bytes\n", o.Hash, o.Type, o.ContentLen)
-			} else {
+		err := repository.ForEachObject(func(object git.Object) error {
+			if !verbose {
 				fmt.Println(object.Hash)
+				return nil
 			}
-		}
+
+			o, err := repository.OpenObject(object.Hash)
+			if err == nil {
+				o, err = repository.ApplyDelta(o)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", object.Hash, err)
+			}
+
+			fmt.Printf("%s %s %d bytes\n", o.Hash, o.Type, o.ContentLen)
+			return nil
+		})
+		check(err)
 	} else {
-		o, err := repository.OpenObject(reference)
+		hash, err := repository.ResolveRevision(reference)
 		check(err)
 
-		builtObject := repository.ApplyDelta(o)
+		header, reader, err := repository.OpenObjectReader(hash)
+		check(err)
+		defer reader.Close()
 
-		if builtObject.Type == git.OBJECT_TYPE_TREE {
-			tree, err := repository.ConvertTree(builtObject.Content)
-			if err != nil {
-				panic(err)
-			}
+		// blobs are copied as they are read, other objects are parsed
+		if header.Type == git.OBJECT_TYPE_BLOB {
+			_, err = io.Copy(os.Stdout, reader)
+			check(err)
+			return
+		}
+
+		content, err := io.ReadAll(reader)
+		check(err)
+
+		if header.Type == git.OBJECT_TYPE_TREE {
+			tree, err := repository.ConvertTree(content)
+			check(err)
 			fmt.Print(tree)
-		} else {
-			fmt.Print(string(builtObject.Content))
+		} else if header.Type == git.OBJECT_TYPE_COMMIT {
+			commit, err := git.ParseCommit(content)
+			check(err)
+			fmt.Print(commit)
+		} else if header.Type == git.OBJECT_TYPE_TAG {
+			tag, err := git.ParseTag(content)
+			check(err)
+			fmt.Print(tag)
 		}
 	}
 }
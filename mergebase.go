@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/mycroft/git-reader/internal/git"
+)
+
+// resolveCommits resolves revisions into commit hashes
+func resolveCommits(repository git.Repository, revs []string) ([]git.ObjectID, error) {
+	hashes := make([]git.ObjectID, 0, len(revs))
+
+	for _, rev := range revs {
+		hash, err := repository.ResolveRevision(rev + "^{commit}")
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, nil
+}
+
+func runMergeBase(repository git.Repository, args []string) error {
+	var all, octopus bool
+
+	flags := flag.NewFlagSet("merge-base", flag.ExitOnError)
+	flags.BoolVar(&all, "all", false, "Output all merge bases instead of the first one")
+	flags.BoolVar(&octopus, "octopus", false, "Compute the best common ancestors of all commits")
+	revs := parseArgs(flags, args)
+
+	if (octopus && len(revs) < 1) || (!octopus && len(revs) < 2) {
+		return fmt.Errorf("usage: merge-base [-all] [-octopus] <rev> <rev>...")
+	}
+
+	hashes, err := resolveCommits(repository, revs)
+	if err != nil {
+		return err
+	}
+
+	var bases []git.ObjectID
+	if octopus {
+		bases, err = repository.OctopusMergeBases(hashes...)
+	} else {
+		bases, err = repository.MergeBases(hashes[0], hashes[1:]...)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(bases) == 0 {
+		return git.ErrNoMergeBase
+	}
+
+	if !all {
+		bases = bases[:1]
+	}
+
+	for _, base := range bases {
+		fmt.Println(base)
+	}
+
+	return nil
+}
+
+// runAheadBehind prints the number of commits in the first revision but not the second one, and the other way around
+func runAheadBehind(repository git.Repository, args []string) error {
+	flags := flag.NewFlagSet("ahead-behind", flag.ExitOnError)
+	revs := parseArgs(flags, args)
+
+	if len(revs) != 2 {
+		return fmt.Errorf("usage: ahead-behind <rev> <base-rev>")
+	}
+
+	hashes, err := resolveCommits(repository, revs)
+	if err != nil {
+		return err
+	}
+
+	ahead, behind, err := repository.AheadBehind(hashes[0], hashes[1])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d\t%d\n", ahead, behind)
+
+	return nil
+}